@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"ecommerce-crawler/internal/classifier"
 	"ecommerce-crawler/internal/crawler"
 	"ecommerce-crawler/internal/utils"
+	"ecommerce-crawler/internal/visited"
 )
 
 func main() {
+	visitedBackend := flag.String("visited", "hash", `visited URL set: "hash", "bloom" or "disk"`)
+	resume := flag.Bool("resume", false, "with -visited=disk, keep the visited set of the previous run")
+	catalog := flag.Bool("catalog", false, "also enumerate the public catalog endpoints and feeds of detected platforms")
+	incremental := flag.Bool("incremental", false, "skip sitemap products whose lastmod has not moved since the previous run")
+	flag.Parse()
+
 	// Set up root context
     ctx, cancel := context.WithCancel(context.Background())
     defer cancel()
@@ -31,6 +40,17 @@ func main() {
 	crawlDelay := 1 * time.Second
 	userAgent := "EcommerceCrawler/1.0 (+https://github.com/yourusername/ecommerce-crawler)"
 	outputFile := "outputs/product_urls.json"
+	visitedFile := "outputs/visited.db"
+
+	domainConfigs, err := crawler.LoadDomainConfigs("configs/domains.json")
+	if err != nil {
+		logger.Debug("No domain config loaded", "error", err)
+	}
+
+	lexicons, err := crawler.LoadLexicons("configs/lexicons")
+	if err != nil {
+		logger.Debug("No lexicons loaded", "error", err)
+	}
 
 	// Create crawler instance
 	crawler := crawler.NewCrawler(
@@ -44,6 +64,51 @@ func main() {
 		logger,
 	)
 
+	// Per-domain tuning is optional
+	for domain, cfg := range domainConfigs {
+		crawler.SetDomainConfig(domain, cfg)
+	}
+
+	// Extra or replacement phrase lexicons, one <lang>.json per language
+	for lang, lex := range lexicons {
+		crawler.SetLexicon(lang, lex)
+	}
+
+	// Platform catalog endpoints list products the site graph may not reach
+	crawler.SetCatalogDiscovery(*catalog)
+
+	// Re-crawls can reuse what the previous run found for unchanged products
+	crawler.SetIncremental(*incremental)
+
+	// Large crawls can trade exactness or memory for the visited set
+	switch *visitedBackend {
+	case "hash":
+	case "bloom":
+		crawler.SetVisitedSet(visited.NewBloomSet(0.001))
+	case "disk":
+		// A fresh crawl starts from an empty set; a resumed one skips what
+		// the previous run queued or fetched, apart from the seeds
+		open := visited.CreateDiskSet
+		if *resume {
+			open = visited.OpenDiskSet
+		}
+		set, err := open(visitedFile)
+		if err != nil {
+			logger.Error("Failed to open visited set", "error", err)
+			os.Exit(1)
+		}
+		crawler.SetVisitedSet(set)
+	default:
+		logger.Error("Unknown visited set backend", "backend", *visitedBackend)
+		os.Exit(2)
+	}
+
+	// Use the trained classifier when one has been produced by `detector train`
+	if model, err := classifier.Load("configs/product_model.json"); err == nil {
+		crawler.SetModel(model)
+		logger.Info("Loaded product classifier model")
+	}
+
 	// Handle signals for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
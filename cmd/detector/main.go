@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"ecommerce-crawler/internal/classifier"
+	"ecommerce-crawler/internal/crawler"
+	"ecommerce-crawler/internal/evaluation"
+	"ecommerce-crawler/internal/utils"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: detector <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  eval    measure IsProductPage against a labelled corpus")
+	fmt.Fprintln(os.Stderr, "  train   fit a statistical product classifier on a labelled corpus")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "eval":
+		os.Exit(runEval(os.Args[2:]))
+	case "train":
+		os.Exit(runTrain(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	corpusDir := fs.String("corpus", "test/corpus", "corpus directory containing manifest.json")
+	baselinePath := fs.String("baseline", "test/corpus/baseline.json", "committed baseline metrics")
+	update := fs.Bool("update-baseline", false, "write the measured metrics as the new baseline")
+	modelPath := fs.String("model", "", "evaluate a trained model instead of the rule-based scorer")
+	fs.Parse(args)
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+
+	samples, err := evaluation.LoadCorpus(*corpusDir)
+	if err != nil {
+		logger.Error("Failed to load corpus", "error", err)
+		return 1
+	}
+
+	c := crawler.NewCrawler(context.Background(), nil, 1, 0, 0, "", "", logger)
+	if *modelPath != "" {
+		model, err := classifier.Load(*modelPath)
+		if err != nil {
+			logger.Error("Failed to load model", "error", err)
+			return 1
+		}
+		c.SetModel(model)
+	}
+	report := evaluation.Evaluate(samples, c.IsProductPage)
+	printReport(report)
+
+	if *update {
+		if err := evaluation.WriteBaseline(*baselinePath, report); err != nil {
+			logger.Error("Failed to write baseline", "error", err)
+			return 1
+		}
+		fmt.Printf("\nBaseline written to %s\n", *baselinePath)
+		return 0
+	}
+
+	baseline, err := evaluation.LoadBaseline(*baselinePath)
+	if err != nil {
+		logger.Error("Failed to load baseline", "error", err)
+		return 1
+	}
+	if regressions := report.Regressions(baseline); len(regressions) > 0 {
+		fmt.Println("\nFAIL: metrics dropped below baseline")
+		for _, r := range regressions {
+			fmt.Println("  " + r)
+		}
+		return 1
+	}
+	fmt.Println("\nOK: metrics at or above baseline")
+	return 0
+}
+
+func runTrain(args []string) int {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	corpusDir := fs.String("corpus", "test/corpus", "corpus directory containing manifest.json")
+	out := fs.String("out", "configs/product_model.json", "where to write the trained model")
+	opts := classifier.DefaultTrainOptions()
+	fs.IntVar(&opts.Epochs, "epochs", opts.Epochs, "gradient descent epochs")
+	fs.Float64Var(&opts.LearningRate, "lr", opts.LearningRate, "learning rate")
+	fs.Float64Var(&opts.L2, "l2", opts.L2, "L2 regularisation strength")
+	fs.Parse(args)
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+
+	samples, err := evaluation.LoadCorpus(*corpusDir)
+	if err != nil {
+		logger.Error("Failed to load corpus", "error", err)
+		return 1
+	}
+
+	c := crawler.NewCrawler(context.Background(), nil, 1, 0, 0, "", "", logger)
+	var examples []classifier.Example
+	for _, sample := range samples {
+		examples = append(examples, classifier.Example{
+			Features: c.ProductFeatures(sample.URL, sample.Content),
+			Label:    sample.IsProduct(),
+			Domain:   sample.Domain,
+		})
+	}
+
+	model := classifier.Train(examples, opts)
+	model.Calibrate(examples)
+	if err := model.Save(*out); err != nil {
+		logger.Error("Failed to write model", "error", err)
+		return 1
+	}
+
+	fmt.Printf("Trained on %d pages, %d features\n", len(examples), len(model.Weights))
+	fmt.Printf("Threshold %.4f overall\n", model.Threshold)
+	for domain, t := range model.DomainThresholds {
+		fmt.Printf("Threshold %.4f for %s\n", t, domain)
+	}
+	fmt.Printf("Model written to %s\n", *out)
+	return 0
+}
+
+func printReport(report *evaluation.Report) {
+	fmt.Printf("%-24s %9s %9s %9s %5s %5s %5s %5s\n", "domain", "precision", "recall", "f1", "tp", "fp", "tn", "fn")
+	printMetrics("overall", report.Overall)
+	for _, domain := range report.Domains() {
+		printMetrics(domain, *report.PerDomain[domain])
+	}
+
+	fmt.Printf("\n%-24s %9s %5s\n", "page type", "accuracy", "pages")
+	for _, label := range report.Labels() {
+		m := report.PerLabel[label]
+		fmt.Printf("%-24s %9.4f %5d\n", label, m.Accuracy,
+			m.TruePositives+m.FalsePositives+m.TrueNegatives+m.FalseNegatives)
+	}
+
+	if len(report.Misclassified) > 0 {
+		fmt.Println("\nMisclassified:")
+		for _, m := range report.Misclassified {
+			kind := "false negative"
+			if m.Predicted {
+				kind = "false positive"
+			}
+			fmt.Printf("  %-15s %s (%s)\n", kind, m.Sample.File, m.Sample.URL)
+		}
+	}
+}
+
+func printMetrics(name string, m evaluation.Metrics) {
+	fmt.Printf("%-24s %9.4f %9.4f %9.4f %5d %5d %5d %5d\n",
+		name, m.Precision, m.Recall, m.F1,
+		m.TruePositives, m.FalsePositives, m.TrueNegatives, m.FalseNegatives)
+}
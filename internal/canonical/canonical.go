@@ -0,0 +1,230 @@
+// Package canonical turns URLs into one canonical form so that the same
+// page is visited, deduplicated and reported under a single URL
+package canonical
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/idna"
+)
+
+// TrackingParams are dropped from every URL. A trailing "*" matches a prefix.
+var TrackingParams = []string{
+	"utm_*", "gclid", "gclsrc", "dclid", "fbclid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "igshid", "srsltid",
+}
+
+// SessionParams carry session ids and are dropped from every URL
+var SessionParams = []string{
+	"jsessionid", "phpsessid", "aspsessionid", "sid", "sessionid",
+	"session_id", "cfid", "cftoken",
+}
+
+// Rules decide which query parameters of a domain are significant
+type Rules struct {
+	// Allow lists the only parameters kept; empty keeps all but the denied
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists parameters dropped on top of tracking and session ids
+	Deny []string `json:"deny,omitempty"`
+}
+
+// Canonicalizer applies the canonical form plus per-domain rules
+type Canonicalizer struct {
+	mu    sync.RWMutex
+	rules map[string]Rules // host -> rules
+}
+
+// New returns a canonicalizer without per-domain rules
+func New() *Canonicalizer {
+	return &Canonicalizer{rules: make(map[string]Rules)}
+}
+
+// SetRules sets the parameter rules of a host and its subdomains
+func (c *Canonicalizer) SetRules(host string, rules Rules) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules[strings.ToLower(host)] = rules
+}
+
+// rulesFor returns the rules of the host or its closest parent domain
+func (c *Canonicalizer) rulesFor(host string) Rules {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for {
+		if rules, ok := c.rules[host]; ok {
+			return rules
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return Rules{}
+		}
+		host = host[i+1:]
+	}
+}
+
+// Canonicalize returns the canonical form of an absolute URL:
+//   - scheme and host lowercased, IDN hosts in punycode, default ports removed
+//   - percent-encoding normalised, dot segments, duplicate and trailing
+//     slashes removed
+//   - tracking, session and denied parameters dropped, the rest sorted
+//   - fragment removed
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	// "example.com/x" has no scheme; treat it as https
+	if u.Scheme == "" && u.Host == "" && !strings.HasPrefix(rawURL, "/") {
+		if u, err = url.Parse("https://" + rawURL); err != nil {
+			return "", err
+		}
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = canonicalHost(u.Scheme, u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	// Session ids can also ride in the path: /p/1;jsessionid=ABC
+	escaped := u.EscapedPath()
+	if i := strings.IndexByte(escaped, ';'); i >= 0 && isSessionSegment(escaped[i+1:]) {
+		escaped = escaped[:i]
+	}
+	escaped = cleanPath(normalizeEscapes(escaped))
+	if unescaped, err := url.PathUnescape(escaped); err == nil {
+		u.Path = unescaped
+		u.RawPath = escaped
+	}
+
+	u.RawQuery = c.canonicalQuery(u.Hostname(), u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// canonicalHost lowercases the host, converts IDN labels to punycode and
+// drops the scheme's default port
+func canonicalHost(scheme, host string) string {
+	hostname, port := host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, p
+	}
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if ascii, err := idna.Lookup.ToASCII(hostname); err == nil {
+		hostname = ascii
+	}
+
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port == "" {
+		if strings.Contains(hostname, ":") {
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+// normalizeEscapes decodes escaped unreserved characters and uppercases
+// the hex digits of the escapes that remain
+func normalizeEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			ch := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(ch) {
+				b.WriteByte(ch)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// cleanPath removes dot segments and duplicate and trailing slashes
+func cleanPath(p string) string {
+	if p == "" || p == "/" {
+		return "/"
+	}
+	p = path.Clean("/" + p)
+	return strings.TrimSuffix(p, "/")
+}
+
+func (c *Canonicalizer) canonicalQuery(host, rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Keep what parsed; a stray "%" should not lose the whole query
+		if len(query) == 0 {
+			return rawQuery
+		}
+	}
+
+	rules := c.rulesFor(strings.ToLower(host))
+	for key := range query {
+		switch {
+		case MatchParam(key, TrackingParams), MatchParam(key, SessionParams):
+			query.Del(key)
+		case len(rules.Allow) > 0 && !MatchParam(key, rules.Allow):
+			query.Del(key)
+		case MatchParam(key, rules.Deny):
+			query.Del(key)
+		}
+	}
+	return query.Encode()
+}
+
+// MatchParam reports whether a query key is one of the params, where
+// "prefix_*" matches any key with that prefix. Matching ignores case.
+func MatchParam(key string, params []string) bool {
+	key = strings.ToLower(key)
+	for _, param := range params {
+		param = strings.ToLower(param)
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+	return false
+}
+
+func isSessionSegment(segment string) bool {
+	name, _, _ := strings.Cut(segment, "=")
+	return MatchParam(name, SessionParams)
+}
+
+func isUnreserved(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' ||
+		ch == '-' || ch == '.' || ch == '_' || ch == '~'
+}
+
+func isHex(ch byte) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func unhex(ch byte) byte {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
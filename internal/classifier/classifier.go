@@ -0,0 +1,193 @@
+// Package classifier implements a logistic-regression product classifier
+// over sparse named features
+package classifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Example is one labelled feature vector used for training
+type Example struct {
+	Features map[string]float64
+	Label    bool
+	Domain   string
+}
+
+// TrainOptions controls gradient descent
+type TrainOptions struct {
+	Epochs       int
+	LearningRate float64
+	L2           float64 // Weight decay, keeps rare tokens from dominating
+}
+
+// DefaultTrainOptions are reasonable settings for a few hundred pages
+func DefaultTrainOptions() TrainOptions {
+	return TrainOptions{
+		Epochs:       500,
+		LearningRate: 0.1,
+		L2:           0.001,
+	}
+}
+
+// Model is a trained logistic-regression model with calibrated thresholds
+type Model struct {
+	Weights          map[string]float64 `json:"weights"`
+	Bias             float64            `json:"bias"`
+	Threshold        float64            `json:"threshold"`
+	DomainThresholds map[string]float64 `json:"domain_thresholds,omitempty"`
+}
+
+// Train fits a model with batch gradient descent
+func Train(examples []Example, opts TrainOptions) *Model {
+	m := &Model{
+		Weights:          make(map[string]float64),
+		Threshold:        0.5,
+		DomainThresholds: make(map[string]float64),
+	}
+	if len(examples) == 0 {
+		return m
+	}
+
+	n := float64(len(examples))
+	for epoch := 0; epoch < opts.Epochs; epoch++ {
+		gradients := make(map[string]float64)
+		biasGradient := 0.0
+
+		for _, ex := range examples {
+			err := m.Probability(ex.Features) - label(ex.Label)
+			for name, value := range ex.Features {
+				gradients[name] += err * value
+			}
+			biasGradient += err
+		}
+
+		for name, g := range gradients {
+			m.Weights[name] -= opts.LearningRate * (g/n + opts.L2*m.Weights[name])
+		}
+		m.Bias -= opts.LearningRate * biasGradient / n
+	}
+
+	return m
+}
+
+// Probability returns the model's estimate that the features describe a product
+func (m *Model) Probability(features map[string]float64) float64 {
+	z := m.Bias
+	for name, value := range features {
+		z += m.Weights[name] * value
+	}
+	return 1 / (1 + math.Exp(-z))
+}
+
+// ThresholdFor returns the calibrated threshold for a domain
+func (m *Model) ThresholdFor(domain string) float64 {
+	if t, ok := m.DomainThresholds[domain]; ok {
+		return t
+	}
+	return m.Threshold
+}
+
+// Predict classifies the features using the domain's threshold
+func (m *Model) Predict(domain string, features map[string]float64) bool {
+	return m.Probability(features) >= m.ThresholdFor(domain)
+}
+
+// Calibrate picks the F1-maximising threshold overall and per domain.
+// Domains without both positive and negative examples keep the overall one.
+func (m *Model) Calibrate(examples []Example) {
+	m.Threshold = bestThreshold(m, examples, 0.5)
+
+	byDomain := make(map[string][]Example)
+	for _, ex := range examples {
+		byDomain[ex.Domain] = append(byDomain[ex.Domain], ex)
+	}
+
+	m.DomainThresholds = make(map[string]float64)
+	for domain, domainExamples := range byDomain {
+		positives := 0
+		for _, ex := range domainExamples {
+			if ex.Label {
+				positives++
+			}
+		}
+		if domain == "" || positives == 0 || positives == len(domainExamples) {
+			continue
+		}
+		m.DomainThresholds[domain] = bestThreshold(m, domainExamples, m.Threshold)
+	}
+}
+
+// bestThreshold tries each observed probability as a cut-off and keeps
+// the one with the highest F1, preferring the one closest to fallback
+func bestThreshold(m *Model, examples []Example, fallback float64) float64 {
+	type scored struct {
+		p     float64
+		label bool
+	}
+	var points []scored
+	for _, ex := range examples {
+		points = append(points, scored{m.Probability(ex.Features), ex.Label})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].p < points[j].p })
+
+	best, bestF1 := fallback, -1.0
+	for _, candidate := range points {
+		tp, fp, fn := 0, 0, 0
+		for _, pt := range points {
+			predicted := pt.p >= candidate.p
+			switch {
+			case predicted && pt.label:
+				tp++
+			case predicted && !pt.label:
+				fp++
+			case !predicted && pt.label:
+				fn++
+			}
+		}
+		f1 := 0.0
+		if tp > 0 {
+			f1 = 2 * float64(tp) / float64(2*tp+fp+fn)
+		}
+		if f1 > bestF1 || (f1 == bestF1 && math.Abs(candidate.p-fallback) < math.Abs(best-fallback)) {
+			best, bestF1 = candidate.p, f1
+		}
+	}
+	return best
+}
+
+func label(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Load reads a model file written by Save
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model: %w", err)
+	}
+
+	var m Model
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse model: %w", err)
+	}
+	if m.Weights == nil {
+		m.Weights = make(map[string]float64)
+	}
+	return &m, nil
+}
+
+// Save writes the model as JSON
+func (m *Model) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
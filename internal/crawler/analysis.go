@@ -0,0 +1,402 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Anchor is a hyperlink found on the page
+type Anchor struct {
+	Href string
+	Text string
+}
+
+// LinkOrigin tells where on the page a link was found
+type LinkOrigin string
+
+const (
+	OriginAnchor    LinkOrigin = "anchor"    // <a href>
+	OriginNext      LinkOrigin = "next"      // <link rel="next">
+	OriginPrev      LinkOrigin = "prev"      // <link rel="prev">
+	OriginCanonical LinkOrigin = "canonical" // <link rel="canonical">
+	OriginAlternate LinkOrigin = "alternate" // <link rel="alternate" hreflang>
+	OriginArea      LinkOrigin = "area"      // <area href> in image maps
+	OriginNoscript  LinkOrigin = "noscript"  // links inside <noscript>
+	OriginData      LinkOrigin = "data"      // data-href / data-url attributes
+	OriginState     LinkOrigin = "state"     // inline JavaScript state
+	OriginRefresh   LinkOrigin = "refresh"   // <meta http-equiv="refresh"> target
+)
+
+// Link is a followable URL with the source it came from
+type Link struct {
+	Href   string
+	Origin LinkOrigin
+	Text   string // anchor text, lowercased
+}
+
+// isPagination reports whether the link moves through the same listing
+func (l Link) isPagination() bool {
+	return l.Origin == OriginNext || l.Origin == OriginPrev
+}
+
+// samePage reports whether the link leads to another URL of the same
+// page: its canonical, a language version or a refresh redirect
+func (l Link) samePage() bool {
+	return l.Origin == OriginCanonical || l.Origin == OriginAlternate || l.Origin == OriginRefresh
+}
+
+// script is an inline script block kept for state parsing
+type script struct {
+	ID   string
+	Type string
+	Text string
+}
+
+// PageAnalysis is the result of parsing a page once. It holds the parsed
+// document and the DOM facts every consumer needs, collected in a single
+// traversal, so detection, classification, product extraction and link
+// extraction never re-parse or re-walk the page.
+type PageAnalysis struct {
+	URL  string
+	Doc  *goquery.Document
+	Lang string // <html lang>, e.g. "hi-IN"
+
+	Title       string
+	Text        string // visible text, whitespace-collapsed
+	BaseHref    string // <base href>, relative links resolve against it
+	Canonical   string
+	Meta        map[string][]string // name / property -> content values
+	Anchors     []Anchor
+	Links       []Link   // every link source, anchors included
+	CTATexts    []string // lowercased text of links and buttons
+	Breadcrumbs string   // lowercased text of breadcrumb containers
+	Headings    string   // lowercased text of h1-h3 headings
+	MainText    string   // lowercased text of <main> or role="main"
+	JSONLD      []map[string]interface{}
+	ScriptSrcs  []string // src of external scripts
+	Classes     map[string]bool
+	ItemProps   map[string]bool
+
+	ElementCount int
+	AnchorCount  int
+
+	HasPagination       bool
+	HasProductMicrodata bool
+
+	scripts []script
+	state   *inlineState
+}
+
+// invisibleElements hold text that is never rendered as page content
+var invisibleElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+}
+
+var breadcrumbClasses = map[string]bool{
+	"breadcrumb": true, "breadcrumbs": true, "bc": true, "breadcrumb-trail": true,
+}
+
+// AnalyzePage parses the content and collects the page facts
+func AnalyzePage(urlStr string, content string) (*PageAnalysis, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &PageAnalysis{
+		URL:       urlStr,
+		Doc:       doc,
+		Meta:      make(map[string][]string),
+		Classes:   make(map[string]bool),
+		ItemProps: make(map[string]bool),
+	}
+	var text strings.Builder
+	for _, n := range doc.Nodes {
+		a.walk(n, &text)
+	}
+	a.Text = strings.Join(strings.Fields(text.String()), " ")
+	a.parseJSONLD()
+	return a, nil
+}
+
+// analyze parses the page, logging parse failures the way callers used to
+func (c *Crawler) analyze(urlStr string, content string) *PageAnalysis {
+	a, err := AnalyzePage(urlStr, content)
+	if err != nil {
+		c.logger.Error("Failed to parse HTML", "url", urlStr, "error", err)
+		return nil
+	}
+	return a
+}
+
+func (a *PageAnalysis) walk(n *html.Node, text *strings.Builder) {
+	switch n.Type {
+	case html.ElementNode:
+		a.visit(n)
+		if invisibleElements[n.Data] {
+			return
+		}
+	case html.TextNode:
+		text.WriteString(n.Data)
+		text.WriteByte(' ')
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		a.walk(child, text)
+	}
+}
+
+func (a *PageAnalysis) visit(n *html.Node) {
+	a.ElementCount++
+
+	class := strings.ToLower(attr(n, "class"))
+	crumb := false
+	for _, name := range strings.Fields(class) {
+		a.Classes[name] = true
+		if name == "pagination" || name == "pager" {
+			a.HasPagination = true
+		}
+		if breadcrumbClasses[name] {
+			crumb = true
+		}
+	}
+	if crumb {
+		a.Breadcrumbs += " " + strings.ToLower(nodeText(n))
+	}
+	if n.Data == "main" || strings.EqualFold(attr(n, "role"), "main") {
+		a.MainText += " " + collapsedText(n)
+	}
+	if prop := attr(n, "itemprop"); prop != "" {
+		a.ItemProps[strings.ToLower(prop)] = true
+	}
+	if strings.Contains(strings.ToLower(attr(n, "itemtype")), "schema.org/product") {
+		a.HasProductMicrodata = true
+	}
+
+	// Product tiles often link through data attributes
+	for _, key := range []string{"data-href", "data-url"} {
+		if href := strings.TrimSpace(attr(n, key)); href != "" {
+			a.addLink(href, OriginData)
+		}
+	}
+
+	switch n.Data {
+	case "a":
+		a.AnchorCount++
+		text := strings.TrimSpace(nodeText(n))
+		a.CTATexts = append(a.CTATexts, strings.ToLower(text))
+		if href, ok := attrOK(n, "href"); ok {
+			a.Anchors = append(a.Anchors, Anchor{Href: href, Text: text})
+			if a.addLink(href, OriginAnchor) {
+				a.Links[len(a.Links)-1].Text = strings.ToLower(text)
+			}
+		}
+	case "area":
+		if href, ok := attrOK(n, "href"); ok {
+			a.addLink(href, OriginArea)
+		}
+	case "noscript":
+		a.noscriptLinks(nodeText(n))
+	case "button":
+		a.CTATexts = append(a.CTATexts, strings.ToLower(strings.TrimSpace(nodeText(n))))
+	case "h1", "h2", "h3":
+		a.Headings += " " + collapsedText(n)
+	case "html":
+		if a.Lang == "" {
+			a.Lang = strings.TrimSpace(attr(n, "lang"))
+		}
+	case "title":
+		if a.Title == "" {
+			a.Title = strings.TrimSpace(nodeText(n))
+		}
+	case "base":
+		if href, ok := attrOK(n, "href"); ok && a.BaseHref == "" {
+			a.BaseHref = strings.TrimSpace(href)
+		}
+	case "meta":
+		content := attr(n, "content")
+		if strings.EqualFold(attr(n, "http-equiv"), "refresh") {
+			a.addLink(refreshTarget(content), OriginRefresh)
+		}
+		for _, key := range []string{attr(n, "property"), attr(n, "name")} {
+			if key != "" {
+				key = strings.ToLower(key)
+				a.Meta[key] = append(a.Meta[key], strings.TrimSpace(content))
+			}
+		}
+	case "link":
+		href := strings.TrimSpace(attr(n, "href"))
+		for _, rel := range strings.Fields(strings.ToLower(attr(n, "rel"))) {
+			switch rel {
+			case "canonical":
+				if a.Canonical == "" {
+					a.Canonical = href
+				}
+				a.addLink(href, OriginCanonical)
+			case "next", "prev":
+				a.HasPagination = true
+				a.addLink(href, LinkOrigin(rel))
+			case "alternate":
+				// Language versions only, not feeds
+				if attr(n, "hreflang") != "" {
+					a.addLink(href, OriginAlternate)
+				}
+			}
+		}
+	case "script":
+		if src := strings.TrimSpace(attr(n, "src")); src != "" {
+			a.ScriptSrcs = append(a.ScriptSrcs, src)
+		}
+		a.scripts = append(a.scripts, script{
+			ID:   attr(n, "id"),
+			Type: strings.ToLower(attr(n, "type")),
+			Text: nodeText(n),
+		})
+	}
+}
+
+// addLink records the link and reports whether it did; empty and
+// javascript: hrefs lead nowhere
+func (a *PageAnalysis) addLink(href string, origin LinkOrigin) bool {
+	target := strings.ToLower(strings.TrimSpace(href))
+	if target == "" || strings.HasPrefix(target, "javascript:") {
+		return false
+	}
+	a.Links = append(a.Links, Link{Href: href, Origin: origin})
+	return true
+}
+
+// BaseURL returns the URL relative links resolve against: the page URL,
+// or the <base href> resolved against it
+func (a *PageAnalysis) BaseURL() (*url.URL, error) {
+	page, err := url.Parse(a.URL)
+	if err != nil || a.BaseHref == "" {
+		return page, err
+	}
+	ref, err := url.Parse(a.BaseHref)
+	if err != nil {
+		return page, nil
+	}
+	return page.ResolveReference(ref), nil
+}
+
+// resolve makes href absolute against the document base
+func (a *PageAnalysis) resolve(href string) string {
+	base, err := a.BaseURL()
+	if err != nil {
+		return href
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// refreshTarget reads the URL of a meta refresh such as "5; url=/new".
+// A refresh without a URL reloads the page and has no target.
+func refreshTarget(content string) string {
+	for _, part := range strings.Split(content, ";") {
+		part = strings.TrimSpace(part)
+		if len(part) > 4 && strings.EqualFold(part[:4], "url=") {
+			return strings.Trim(strings.TrimSpace(part[4:]), `'"`)
+		}
+	}
+	return ""
+}
+
+// noscriptLinks collects the links of a <noscript> block, which the
+// parser keeps as raw text
+func (a *PageAnalysis) noscriptLinks(content string) {
+	if !strings.Contains(content, "href") {
+		return
+	}
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return
+	}
+
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "area") {
+			if href, ok := attrOK(n, "href"); ok {
+				a.addLink(href, OriginNoscript)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	for _, n := range nodes {
+		collect(n)
+	}
+}
+
+func (a *PageAnalysis) parseJSONLD() {
+	for _, s := range a.scripts {
+		if s.Type != "application/ld+json" {
+			continue
+		}
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text)), &data); err != nil {
+			continue
+		}
+		a.JSONLD = appendJSONLDNodes(a.JSONLD, data)
+	}
+}
+
+// MetaContent returns the first content value for a meta name or property
+func (a *PageAnalysis) MetaContent(key string) string {
+	if values := a.Meta[strings.ToLower(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// State returns the page's inline JavaScript state, parsed on first use
+func (a *PageAnalysis) State() *inlineState {
+	if a.state == nil {
+		a.state = parseInlineState(a.scripts)
+	}
+	return a.state
+}
+
+func attr(n *html.Node, key string) string {
+	value, _ := attrOK(n, key)
+	return value
+}
+
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, at := range n.Attr {
+		if at.Key == key {
+			return at.Val, true
+		}
+	}
+	return "", false
+}
+
+// collapsedText is the node's lowercased text with whitespace collapsed
+func collapsedText(n *html.Node) string {
+	return strings.Join(strings.Fields(strings.ToLower(nodeText(n))), " ")
+}
+
+// nodeText concatenates the text below n
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return b.String()
+}
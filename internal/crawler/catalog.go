@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"ecommerce-crawler/pkg/workerpool"
+)
+
+// maxCatalogPages bounds how far a catalog endpoint is paged through
+const maxCatalogPages = 100
+
+// catalogEndpoint is a public product listing of a storefront platform
+type catalogEndpoint struct {
+	// Path of page n, e.g. "/products.json?limit=250&page=%d"
+	Path string
+	// PageSize is the number of products on a full page
+	PageSize int
+	// Parse turns one response into product URLs
+	Parse func(base *url.URL, body []byte) ([]string, error)
+}
+
+var catalogEndpoints = map[Platform][]catalogEndpoint{
+	PlatformShopify: {
+		{Path: "/products.json?limit=250&page=%d", PageSize: 250, Parse: parseShopifyProducts},
+	},
+	PlatformWooCommerce: {
+		{Path: "/wp-json/wc/store/v1/products?per_page=100&page=%d", PageSize: 100, Parse: parseStoreAPIProducts},
+	},
+}
+
+// catalogListings are HTML pages listing the whole catalog; they are
+// queued as ordinary listing tasks
+var catalogListings = map[Platform][]string{
+	PlatformShopify: {"/collections/all"},
+}
+
+// catalogFeeds are RSS and Atom product feeds a platform publishes at a
+// fixed path; each item links to a product page
+var catalogFeeds = map[Platform][]string{
+	PlatformShopify:     {"/collections/all.atom"},
+	PlatformWooCommerce: {"/?post_type=product&feed=rss2"},
+	PlatformMagento:     {"/rss/feed/index/type/new_products/"},
+	PlatformBigCommerce: {"/rss.php?type=rss", "/rss.php?action=featuredproducts&type=rss"},
+}
+
+// SetCatalogDiscovery turns enumeration of storefront catalog endpoints
+// on or off. It is off by default.
+func (c *Crawler) SetCatalogDiscovery(enabled bool) {
+	c.catalogDiscovery = enabled
+}
+
+// discoverCatalog queues the product URLs the catalog of the seed's
+// platform lists, one level below the seed
+func (c *Crawler) discoverCatalog(task *workerpool.Task) {
+	catalogURLs, err := c.checkCatalog(task)
+	if err != nil {
+		c.logger.Debug("Catalog discovery failed", "domain", task.Domain, "error", err)
+	}
+	for _, u := range catalogURLs {
+		c.enqueue(&workerpool.Task{
+			URL:      u,
+			Depth:    task.Depth + 1,
+			Domain:   task.Domain,
+			Origin:   "catalog",
+			Priority: priorityCatalog,
+		})
+	}
+}
+
+// checkCatalog pages through the catalog endpoints and reads the product
+// feeds of the domain's platform, and returns the product URLs they list.
+// Every request goes through the cached robots.txt and the per-host
+// crawl delay.
+func (c *Crawler) checkCatalog(task *workerpool.Task) ([]string, error) {
+	base, err := url.Parse(task.URL)
+	if err != nil {
+		return nil, err
+	}
+	platform := c.platform(task.Domain)
+
+	var productURLs []string
+	for _, path := range catalogListings[platform] {
+		productURLs = append(productURLs, base.ResolveReference(&url.URL{Path: path}).String())
+	}
+
+	for _, endpoint := range catalogEndpoints[platform] {
+		for page := 1; page <= maxCatalogPages; page++ {
+			ref, err := url.Parse(fmt.Sprintf(endpoint.Path, page))
+			if err != nil {
+				return productURLs, err
+			}
+			pageURL := base.ResolveReference(ref).String()
+
+			allowed, crawlDelay, err := c.checkRobotsTxt(&workerpool.Task{URL: pageURL, Domain: task.Domain})
+			if err != nil || !allowed {
+				c.logger.Debug("Catalog endpoint disallowed", "url", pageURL)
+				break
+			}
+			if err := c.throttle.wait(c.ctx, task.Domain, PageTypeListing, crawlDelay); err != nil {
+				return productURLs, err
+			}
+
+			content, err := c.httpClient.FetchWithContext(c.ctx, pageURL)
+			if err != nil {
+				// Endpoint missing or disabled on this store
+				c.logger.Debug("Catalog endpoint unavailable", "url", pageURL, "error", err)
+				break
+			}
+			urls, err := endpoint.Parse(base, []byte(content))
+			if err != nil {
+				c.logger.Debug("Failed to parse catalog page", "url", pageURL, "error", err)
+				break
+			}
+			productURLs = append(productURLs, urls...)
+
+			if len(urls) < endpoint.PageSize {
+				break
+			}
+		}
+	}
+
+	for _, path := range catalogFeeds[platform] {
+		ref, err := url.Parse(path)
+		if err != nil {
+			return productURLs, err
+		}
+		feedURL := base.ResolveReference(ref).String()
+
+		allowed, crawlDelay, err := c.checkRobotsTxt(&workerpool.Task{URL: feedURL, Domain: task.Domain})
+		if err != nil || !allowed {
+			c.logger.Debug("Product feed disallowed", "url", feedURL)
+			continue
+		}
+		if err := c.throttle.wait(c.ctx, task.Domain, PageTypeListing, crawlDelay); err != nil {
+			return productURLs, err
+		}
+
+		// Feeds are decoded like RSS and Atom sitemaps
+		c.readSitemap(feedURL, sitemapAll, func(entry sitemapEntry) bool {
+			if ref, err := url.Parse(entry.Loc); err == nil {
+				productURLs = append(productURLs, base.ResolveReference(ref).String())
+			}
+			return true
+		})
+	}
+
+	c.logger.Debug("Catalog discovery finished", "domain", task.Domain, "platform", platform, "urls", len(productURLs))
+	return productURLs, nil
+}
+
+// parseShopifyProducts reads /products.json, which lists handles
+func parseShopifyProducts(base *url.URL, body []byte) ([]string, error) {
+	var data struct {
+		Products []struct {
+			Handle string `json:"handle"`
+		} `json:"products"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, p := range data.Products {
+		if p.Handle == "" {
+			continue
+		}
+		ref := &url.URL{Path: "/products/" + strings.Trim(p.Handle, "/")}
+		urls = append(urls, base.ResolveReference(ref).String())
+	}
+	return urls, nil
+}
+
+// parseStoreAPIProducts reads the WooCommerce Store API, which lists permalinks
+func parseStoreAPIProducts(base *url.URL, body []byte) ([]string, error) {
+	var data []struct {
+		Permalink string `json:"permalink"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, p := range data {
+		if p.Permalink == "" {
+			continue
+		}
+		if ref, err := url.Parse(p.Permalink); err == nil {
+			urls = append(urls, base.ResolveReference(ref).String())
+		}
+	}
+	return urls, nil
+}
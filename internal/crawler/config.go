@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"ecommerce-crawler/internal/canonical"
+)
+
+// DomainConfig holds per-domain tuning that cannot be inferred from pages
+type DomainConfig struct {
+	// ProductURLTemplates turn product ids and slugs found in inline
+	// state into URLs, e.g. "/{slug}/p/{id}"
+	ProductURLTemplates []string `json:"product_url_templates,omitempty"`
+
+	// ProductURLPatterns are product URL templates such as "/p/{id}" or
+	// "/{slug}-p-{num}.html" used for URL pattern matching; the crawler
+	// writes the ones it learns to learned_templates.json
+	ProductURLPatterns []string `json:"product_url_patterns,omitempty"`
+
+	// VariantParams are query parameters that select a variant of the
+	// same product (colour, size, ...) rather than a different product
+	VariantParams []string `json:"variant_params,omitempty"`
+
+	// Language selects an extra phrase lexicon ("hi", "es", ...) for
+	// sites that do not declare <html lang>
+	Language string `json:"language,omitempty"`
+
+	// QueryParams lists the significant query parameters ("allow") or the
+	// ones to drop ("deny") when canonicalising the domain's URLs
+	QueryParams canonical.Rules `json:"query_params,omitempty"`
+
+	// Scope selects the hosts crawled with this seed: "exact", "www"
+	// (default), "subdomains" or "registrable"
+	Scope Scope `json:"scope,omitempty"`
+
+	// Harvest overrides the crawler's policy for following product-like
+	// links found on product pages
+	Harvest *HarvestPolicy `json:"harvest,omitempty"`
+}
+
+// SetDomainConfig sets the configuration used for a seed domain (host)
+func (c *Crawler) SetDomainConfig(domain string, cfg DomainConfig) {
+	c.domainConfigs[domain] = cfg
+	c.canon.SetRules(domain, cfg.QueryParams)
+}
+
+// domainConfig returns the config of the host, or of the seed whose
+// scope the host belongs to
+func (c *Crawler) domainConfig(domain string) DomainConfig {
+	if cfg, ok := c.seedConfig(domain); ok {
+		return cfg
+	}
+	key := c.domainKeyOf(domain)
+	for host, cfg := range c.domainConfigs {
+		if c.domainKeyOf(host) == key {
+			return cfg
+		}
+	}
+	return DomainConfig{}
+}
+
+// seedConfig returns the config keyed by the host or by its www. alias.
+// Unlike domainConfig it does not resolve scopes, so seedScope can use it.
+func (c *Crawler) seedConfig(host string) (DomainConfig, bool) {
+	host = strings.ToLower(host)
+	if cfg, ok := c.domainConfigs[host]; ok {
+		return cfg, true
+	}
+	alias := "www." + host
+	if strings.HasPrefix(host, "www.") {
+		alias = strings.TrimPrefix(host, "www.")
+	}
+	cfg, ok := c.domainConfigs[alias]
+	return cfg, ok
+}
+
+// LoadDomainConfigs reads a JSON file mapping domain hosts to their config
+func LoadDomainConfigs(path string) (map[string]DomainConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read domain config: %w", err)
+	}
+
+	configs := make(map[string]DomainConfig)
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse domain config: %w", err)
+	}
+	return configs, nil
+}
@@ -7,10 +7,17 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"ecommerce-crawler/internal/canonical"
+	"ecommerce-crawler/internal/classifier"
+	"ecommerce-crawler/internal/models"
 	"ecommerce-crawler/internal/utils"
+	"ecommerce-crawler/internal/visited"
 	"ecommerce-crawler/pkg/workerpool"
 )
 
@@ -18,7 +25,8 @@ type Crawler struct {
     ctx         context.Context     // Add this line
     domains     []string
     workerPool  *workerpool.WorkerPool
-    visitedURLs *sync.Map
+    visitedURLs visited.Set // URLs queued or fetched
+    readmit     sync.Map    // URLs requeued despite the visited set
     productURLs *DomainURLMap
     httpClient  *HTTPClient
     userAgent   string
@@ -26,28 +34,171 @@ type Crawler struct {
     crawlDelay  time.Duration
     outputFile  string
     logger      *utils.Logger
+
+    pagePolicies  map[PageType]PagePolicy
+    throttle      *typeThrottle
+    domainConfigs map[string]DomainConfig
+    model         *classifier.Model
+    notFound      *softNotFoundIndex
+    lexicons      map[string]Lexicon
+    platforms     sync.Map // domain -> Platform
+    canon         *canonical.Canonicalizer
+    seeds         []string // seed hosts, see scope.go
+    traps         *trapDetector
+    learner       *templateLearner
+    harvest       *harvestBudget
+    duplicates    *nearDuplicates
+    sitemaps      *sitemapTracker
+    recrawl       *recrawlState
+    robots        *robotsCache
+
+    catalogDiscovery bool
+    harvestPolicy    HarvestPolicy
+    incremental      bool
 }
 
 type DomainURLMap struct {
+	count int64 // canonical products, kept for O(1) progress reports
 	sync.Map
 }
 
+// domainProducts holds one record per canonical product of a domain,
+// with the variant URLs that collapsed into it
+type domainProducts struct {
+	mu       sync.Mutex
+	products map[string]*models.Product // canonical URL -> record
+	groups   map[string]string          // group key -> canonical URL
+}
+
 func (m *DomainURLMap) Add(domain, url string) {
-	urls, _ := m.LoadOrStore(domain, &sync.Map{})
-	urls.(*sync.Map).Store(url, true)
+	m.AddProduct(domain, &models.Product{URL: url})
+}
+
+// AddProduct stores the product record, collapsing it into an existing
+// product with the same group id. It reports whether a new product was added.
+func (m *DomainURLMap) AddProduct(domain string, product *models.Product) bool {
+	value, _ := m.LoadOrStore(domain, &domainProducts{
+		products: make(map[string]*models.Product),
+		groups:   make(map[string]string),
+	})
+	dp := value.(*domainProducts)
+
+	key := product.GroupID
+	if key == "" {
+		key = product.URL
+	}
+
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+
+	canonicalURL, grouped := dp.groups[key]
+	if !grouped {
+		canonicalURL = product.URL
+	}
+	existing, ok := dp.products[canonicalURL]
+	if !ok {
+		dp.groups[key] = product.URL
+		dp.products[product.URL] = product
+		atomic.AddInt64(&m.count, 1)
+		return true
+	}
+
+	mergeVariant(existing, product)
+	return false
+}
+
+// mergeVariant records a variant on its canonical product
+func mergeVariant(canonical, variant *models.Product) {
+	for _, u := range append([]string{variant.URL}, variant.Variants...) {
+		if u == canonical.URL {
+			continue
+		}
+		known := false
+		for _, v := range canonical.Variants {
+			if v == u {
+				known = true
+				break
+			}
+		}
+		if !known {
+			canonical.Variants = append(canonical.Variants, u)
+		}
+	}
+}
+
+// AddAlias records URLs serving the same content as a known product. It
+// reports false when the product is not recorded.
+func (m *DomainURLMap) AddAlias(domain, productURL string, aliases []string) bool {
+	value, ok := m.Load(domain)
+	if !ok {
+		return false
+	}
+	dp := value.(*domainProducts)
+
+	dp.mu.Lock()
+	defer dp.mu.Unlock()
+	product, ok := dp.products[productURL]
+	if !ok {
+		return false
+	}
+	for _, alias := range aliases {
+		if alias == product.URL || containsString(product.Aliases, alias) || containsString(product.Variants, alias) {
+			continue
+		}
+		product.Aliases = append(product.Aliases, alias)
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of canonical products across all domains
+func (m *DomainURLMap) Len() int {
+	return int(atomic.LoadInt64(&m.count))
 }
 
 func (m *DomainURLMap) ToJSON() map[string][]string {
 	result := make(map[string][]string)
+	for domain, products := range m.Products() {
+		var urlList []string
+		for _, p := range products {
+			urlList = append(urlList, p.URL)
+		}
+		result[domain] = urlList
+	}
+	return result
+}
+
+// Products returns a copy of the product records per domain, ordered by URL
+func (m *DomainURLMap) Products() map[string][]*models.Product {
+	result := make(map[string][]*models.Product)
 	m.Range(func(key, value interface{}) bool {
 		domain := key.(string)
-		urls := value.(*sync.Map)
-		var urlList []string
-		urls.Range(func(url, _ interface{}) bool {
-			urlList = append(urlList, url.(string))
-			return true
+		dp := value.(*domainProducts)
+
+		dp.mu.Lock()
+		products := make([]*models.Product, 0, len(dp.products))
+		for _, p := range dp.products {
+			record := *p
+			record.Variants = append([]string(nil), p.Variants...)
+			sort.Strings(record.Variants)
+			record.Aliases = append([]string(nil), p.Aliases...)
+			sort.Strings(record.Aliases)
+			products = append(products, &record)
+		}
+		dp.mu.Unlock()
+
+		sort.Slice(products, func(i, j int) bool {
+			return products[i].URL < products[j].URL
 		})
-		result[domain] = urlList
+		result[domain] = products
 		return true
 	})
 	return result
@@ -61,11 +212,18 @@ func NewCrawler(
 	userAgent, outputFile string,
 	logger *utils.Logger,
 ) *Crawler {
-	return &Crawler{
+	var seeds []string
+	for _, domain := range domains {
+		if u, err := url.Parse(domain); err == nil && u.Host != "" {
+			seeds = append(seeds, strings.ToLower(u.Host))
+		}
+	}
+
+	c := &Crawler{
 		ctx:         ctx,
 		domains:     domains,
 		workerPool:  workerpool.NewWorkerPool(maxWorkers, 30*time.Second), // 30s timeout per task
-		visitedURLs: &sync.Map{},
+		visitedURLs: visited.NewHashSet(),
 		productURLs: &DomainURLMap{},
 		httpClient:  NewHTTPClient(logger),
 		userAgent:   userAgent,
@@ -73,21 +231,50 @@ func NewCrawler(
 		crawlDelay:  crawlDelay,
 		outputFile:  outputFile,
 		logger:      logger,
+
+		pagePolicies:  defaultPagePolicies(),
+		throttle:      newTypeThrottle(),
+		domainConfigs: make(map[string]DomainConfig),
+		notFound:      newSoftNotFoundIndex(),
+		lexicons:      defaultLexicons(),
+		canon:         canonical.New(),
+		seeds:         seeds,
+		traps:         newTrapDetector(DefaultTrapLimits()),
+		learner:       newTemplateLearner(),
+		harvest:       newHarvestBudget(),
+		duplicates:    newNearDuplicates(),
+		sitemaps:      newSitemapTracker(DefaultSitemapLimits()),
+		recrawl:       newRecrawlState(),
+		robots:        newRobotsCache(),
+
+		harvestPolicy: DefaultHarvestPolicy(),
 	}
+	c.workerPool.SetDedupe(c.admit)
+	return c
 }
 
 // internal/crawler/crawler.go
 func (c *Crawler) Start(ctx context.Context) error {
+	// What the previous run crawled from sitemaps, for incremental re-crawls
+	if c.incremental {
+		if err := c.loadRecrawlState(); err != nil {
+			c.logger.Warn("Failed to load crawl state", "file", c.recrawlFile(), "error", err)
+		}
+	}
+
 	// Initialize queue
 	for _, domain := range c.domains {
 		parsedURL, err := url.Parse(domain)
 		if err != nil {
 			continue
 		}
-		c.workerPool.AddTask(&workerpool.Task{
-			URL:    domain,
-			Depth:  0,
-			Domain: parsedURL.Host,
+		// Pages and products of the seed's scope share one domain key.
+		// Seeds are fetched even when a resumed visited set holds them.
+		c.requeue(&workerpool.Task{
+			URL:      domain,
+			Depth:    0,
+			Domain:   c.domainKeyOf(parsedURL.Host),
+			Priority: prioritySeed,
 		})
 	}
 
@@ -99,6 +286,7 @@ func (c *Crawler) Start(ctx context.Context) error {
 
 	// Wait for completion
 	<-ctx.Done()
+	defer c.visitedURLs.Close()
 	return c.generateOutput()
 }
 
@@ -126,24 +314,11 @@ func (c *Crawler) monitor(ctx context.Context) {
 }
 
 func (c *Crawler) productCount() int {
-	count := 0
-	c.productURLs.Range(func(_, urls interface{}) bool {
-		urls.(*sync.Map).Range(func(_, _ interface{}) bool {
-			count++
-			return true
-		})
-		return true
-	})
-	return count
+	return c.productURLs.Len()
 }
 
 func (c *Crawler) visitedCount() int {
-	count := 0
-	c.visitedURLs.Range(func(_, _ interface{}) bool {
-		count++
-		return true
-	})
-	return count
+	return c.visitedURLs.Len()
 }
 
 func (c *Crawler) processTask(task *workerpool.Task) error {
@@ -152,15 +327,36 @@ func (c *Crawler) processTask(task *workerpool.Task) error {
         return err
     }
 
-	// Normalize URL first
+	// Normalize URL first; the frontier already dropped URLs seen before
 	normalizedURL := c.normalizeURL(task.URL)
 
-	// Check if we've already visited this URL
-	if _, loaded := c.visitedURLs.LoadOrStore(normalizedURL, true); loaded {
+	c.logger.Debug("Processing URL", "url", normalizedURL, "depth", task.Depth)
+
+	// Skip page types we never want to fetch (cart, account, ...)
+	urlType := c.classifyURL(normalizedURL)
+	policy := c.pagePolicy(urlType)
+	if !policy.Fetch {
+		c.logger.Debug("Skipping URL by page type policy", "url", normalizedURL, "type", urlType)
 		return nil
 	}
 
-	c.logger.Debug("Processing URL", "url", normalizedURL, "depth", task.Depth)
+	// Rate-limit page types such as search results. The task goes back
+	// to the frontier when its slot comes rather than parking a worker.
+	if wait := c.throttle.reserve(task.Domain, normalizedURL, urlType, policy.MinInterval); wait > 0 {
+		c.logger.Debug("Deferring rate-limited page", "url", normalizedURL, "type", urlType, "wait", wait)
+		time.AfterFunc(wait, func() {
+			if c.ctx.Err() == nil {
+				c.requeue(task)
+			}
+		})
+		return nil
+	}
+
+	// Skip URL families that look like crawler traps
+	if allowed, reason := c.traps.check(task.Domain, normalizedURL); !allowed {
+		c.logger.Debug("Skipping likely crawler trap", "url", normalizedURL, "reason", reason)
+		return nil
+	}
 
 	// Check robots.txt first
 	robotsAllowed, crawlDelay, err := c.checkRobotsTxt(task)
@@ -176,28 +372,11 @@ func (c *Crawler) processTask(task *workerpool.Task) error {
 	// Respect crawl delay
 	time.Sleep(crawlDelay)
 
-	// Check sitemap first if we're at the root
-	if task.Depth == 0 {
-		sitemapURLs, err := c.checkSitemap(task.URL)
-		if err == nil && len(sitemapURLs) > 0 {
-			for _, u := range sitemapURLs {
-				// Don't follow sitemap links deeper than max depth
-				if task.Depth+1 <= c.maxDepth {
-					c.workerPool.AddTask(&workerpool.Task{
-						URL:    u,
-						Depth:  task.Depth + 1,
-						Domain: task.Domain,
-					})
-				}
-			}
-		}
-	}
-
 	// Fetch the page with timeout
 	_, cancel := context.WithTimeout(c.ctx, 10*time.Second)
 	defer cancel()
 
-	content, err := c.httpClient.FetchWithContext(c.ctx, task.URL)
+	resp, err := c.httpClient.FetchResponse(c.ctx, task.URL)
     if err != nil {
         if errors.Is(err, ErrTimeout) {
             c.logger.Warn("Timeout while fetching URL",
@@ -208,37 +387,170 @@ func (c *Crawler) processTask(task *workerpool.Task) error {
         return err
     }
 
-	// Detect if this is a product page
-	if c.IsProductPage(normalizedURL, content) {
-		c.productURLs.Add(task.Domain, normalizedURL)
-		c.logger.Info("Found product page", "url", normalizedURL)
-		// Don't crawl further from product pages
+	// Learn what this host serves for missing pages before judging any
+	c.probeNotFound(task.Domain, normalizedURL)
+
+	// Parse once; every later step reuses the analysis
+	analysis := c.analyze(normalizedURL, resp.Body)
+	if analysis == nil {
 		return nil
 	}
 
-	// Extract links and add to queue if we haven't reached max depth
-	if task.Depth < c.maxDepth {
-		links := c.extractLinks(normalizedURL, content)
-		for _, link := range links {
-			c.workerPool.AddTask(&workerpool.Task{
-				URL:    link,
-				Depth:  task.Depth + 1,
-				Domain: task.Domain,
+	// Fingerprint the platform, which selects URL patterns, variant
+	// rules and sitemap locations
+	c.notePlatform(task.Domain, resp, analysis)
+
+	// Check sitemaps at the root, including the platform's own locations
+	if task.Depth == 0 {
+		// Sitemap URLs are queued while the sitemaps are still being read
+		if task.Depth+1 <= c.maxDepth {
+			found := c.checkSitemap(task.URL, task.Domain, c.platformProfile(task.Domain).Sitemaps, func(entry sitemapEntry) {
+				meta := entryMeta(entry)
+				// Products not modified since the last crawl keep their record
+				if loc := c.normalizeURL(entry.Loc); c.unchanged(task.Domain, loc, meta) {
+					c.visitedURLs.Add(loc)
+					c.logger.Debug("Skipped unchanged sitemap URL", "url", loc)
+					return
+				}
+				c.enqueue(&workerpool.Task{
+					URL:      entry.Loc,
+					Depth:    task.Depth + 1,
+					Domain:   task.Domain,
+					Origin:   "sitemap",
+					Priority: sitemapPriority(meta),
+					Sitemap:  meta,
+				})
 			})
+			c.logger.Debug("Sitemaps read", "domain", task.Domain, "urls", found)
+			if c.ctx.Err() == nil {
+				c.sitemapRead(task.Domain)
+			}
+		}
+
+		// Public catalog endpoints of the platform, beside the sitemap.
+		// Paging through them takes long, so it does not hold the worker.
+		if c.catalogDiscovery && task.Depth+1 <= c.maxDepth {
+			go c.discoverCatalog(task)
+		}
+	}
+
+	// A page is productive for its URL template when it finds a new
+	// product or links to product-like URLs not seen before
+	productive := false
+	defer func() { c.traps.record(task.Domain, normalizedURL, productive) }()
+
+	// Classify the page and apply the policy for its type
+	pageType := c.classify(analysis)
+	policy = c.pagePolicy(pageType)
+	c.logger.Debug("Classified page", "url", normalizedURL, "type", pageType)
+
+	if pageType == PageTypeProduct {
+		product := c.productRecord(task.Domain, analysis)
+		// Images and language alternates listed by the sitemap
+		applySitemapMeta(product, task.Sitemap)
+		c.recordCrawl(task, product)
+		// Near-identical text under another URL is an alias of the
+		// first-seen page, not another product
+		if original, ok := c.duplicates.firstSeen(task.Domain, analysis.Text, product); ok &&
+			c.productURLs.AddAlias(task.Domain, original, append([]string{product.URL}, product.Variants...)) {
+			c.logger.Debug("Recorded near-duplicate page as alias", "url", normalizedURL, "original", original)
+		} else {
+			if c.strongProductSignal(analysis) {
+				c.learner.observe(task.Domain, product.URL)
+			}
+			if c.productURLs.AddProduct(task.Domain, product) {
+				productive = true
+				c.logger.Info("Found product page", "url", product.URL)
+			} else {
+				c.logger.Debug("Collapsed product variant", "url", normalizedURL, "group", product.GroupID)
+			}
+		}
+
+		// Follow product-like links of carousels when harvesting is on
+		if c.harvestLinks(task, analysis) {
+			productive = true
+		}
+	} else {
+		c.recordCrawl(task, nil)
+		// Copies of product pages that miss the product threshold end up
+		// as listings, through their related-product tiles; other page
+		// types are not worth fingerprinting
+		if pageType == PageTypeListing {
+			if original, ok := c.duplicates.copyOf(task.Domain, analysis.Text, c.extractProduct(analysis)); ok &&
+				c.productURLs.AddAlias(task.Domain, original, []string{normalizedURL}) {
+				// A copy of a product page leads nowhere the original does not
+				c.logger.Debug("Recorded near-duplicate page as alias", "url", normalizedURL, "original", original)
+				return nil
+			}
+		}
+	}
+	// Harvested pages only lead to further products, never to the site graph
+	if !policy.Expand || task.HarvestDepth > 0 {
+		return nil
+	}
+
+	// Extract links and add to queue if we haven't reached max depth.
+	// Pagination, canonical, language alternates and refresh targets stay
+	// at the page's depth: they lead to the same listing or the same page.
+	// The frontier orders them by how likely they lead to products.
+	links := c.extractLinks(analysis)
+	ctaPhrases := c.lexiconFor(analysis).CTA
+	for _, link := range links {
+		depth := task.Depth + 1
+		if (link.isPagination() || link.samePage()) && task.Depth <= c.maxDepth {
+			depth = task.Depth
+		}
+		if depth > c.maxDepth && !c.beyondMaxDepth(policy, link, depth) {
+			continue
+		}
+		queued := c.enqueue(&workerpool.Task{
+			URL:      link.Href,
+			Depth:    depth,
+			Domain:   task.Domain,
+			Origin:   string(link.Origin),
+			Priority: c.linkPriority(link, pageType, ctaPhrases, depth),
+		})
+		if queued && c.URLPatternMatch(link.Href) {
+			productive = true
 		}
 	}
 
 	return nil
 }
 
+// domainReport is the output entry of one domain
+type domainReport struct {
+	Platform Platform          `json:"platform"`
+	Products []*models.Product `json:"products"`
+
+	SuppressedFamilies []SuppressedFamily `json:"suppressed_families,omitempty"`
+}
+
 func (c *Crawler) generateOutput() error {
 	// Create output directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(c.outputFile), 0755); err != nil {
 		return err
 	}
 
-	// Convert product URLs to JSON structure
-	outputData := c.productURLs.ToJSON()
+	// Convert product records to JSON structure, with each domain's platform
+	outputData := make(map[string]domainReport)
+	for domain, products := range c.productURLs.Products() {
+		outputData[domain] = domainReport{
+			Platform: c.platform(domain),
+			Products: products,
+
+			SuppressedFamilies: c.traps.families(domain),
+		}
+	}
+	for domain, families := range c.GetSuppressedFamilies() {
+		if _, ok := outputData[domain]; !ok {
+			outputData[domain] = domainReport{
+				Platform:           c.platform(domain),
+				Products:           []*models.Product{},
+				SuppressedFamilies: families,
+			}
+		}
+	}
 
 	// Write to file
 	file, err := os.Create(c.outputFile)
@@ -254,6 +566,21 @@ func (c *Crawler) generateOutput() error {
 	}
 
 	c.logger.Info("Output written successfully", "file", c.outputFile)
+
+	// Learned product URL templates, ready to promote to configs/domains.json
+	if len(c.GetLearnedTemplates()) > 0 {
+		templatesFile := filepath.Join(filepath.Dir(c.outputFile), "learned_templates.json")
+		if err := c.writeLearnedTemplates(templatesFile); err != nil {
+			return err
+		}
+		c.logger.Info("Learned URL templates written", "file", templatesFile)
+	}
+
+	if c.incremental {
+		if err := c.writeRecrawlState(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -262,12 +589,19 @@ func (c *Crawler) GetProductURLs() map[string][]string {
     return c.productURLs.ToJSON()
 }
 
-// GetVisitedURLs returns all visited URLs
-func (c *Crawler) GetVisitedURLs() []string {
-    var urls []string
-    c.visitedURLs.Range(func(key, value interface{}) bool {
-        urls = append(urls, key.(string))
-        return true
-    })
-    return urls
-}
\ No newline at end of file
+// GetProducts returns a map of domains to their product records
+func (c *Crawler) GetProducts() map[string][]*models.Product {
+    return c.productURLs.Products()
+}
+
+// VisitedCount returns the number of URLs queued, fetched or skipped so far.
+// It replaces GetVisitedURLs: visited sets keep fingerprints, not the URLs.
+func (c *Crawler) VisitedCount() int {
+	return c.visitedURLs.Len()
+}
+
+// SetVisitedSet replaces the in-memory visited set, e.g. with a Bloom
+// filter or an on-disk set for very large crawls. Call it before Start.
+func (c *Crawler) SetVisitedSet(set visited.Set) {
+	c.visitedURLs = set
+}
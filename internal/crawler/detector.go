@@ -4,30 +4,38 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
-
-	"github.com/PuerkitoBio/goquery"
 )
 
+// productThreshold is the score at which a page counts as a product
+const productThreshold = 50
+
 func (c *Crawler) IsProductPage(urlStr string, content string) bool {
+	// Parse HTML content
+	a := c.analyze(urlStr, content)
+	if a == nil {
+		return false
+	}
+
+	return c.isProduct(a)
+}
+
+func (c *Crawler) productScore(a *PageAnalysis) int {
 	score := 0
+	urlStr := a.URL
 
 	// Technique a: Regex-based and heuristic-based filter
 	if c.URLPatternMatch(urlStr) {
 		score += 20
 	}
 
-	// Parse HTML content
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
-	if err != nil {
-		c.logger.Error("Failed to parse HTML", "url", urlStr, "error", err)
-		return false
-	}
-
-	// Technique b: Meta tags and breadcrumb navigation
-	if c.checkMetaTags(doc) {
+	// Technique b: Meta tags and breadcrumb navigation. og:type=product
+	// is the page declaring itself a product, as structured data does.
+	if strings.ToLower(a.MetaContent("og:type")) == "product" {
+		score += 30
+	} else if c.checkMetaTags(a) {
 		score += 15
 	}
-	if c.checkBreadcrumbs(doc) {
+	if c.checkBreadcrumbs(a) {
 		score += 10
 	}
 
@@ -37,29 +45,29 @@ func (c *Crawler) IsProductPage(urlStr string, content string) bool {
 	}
 
 	// Technique d: Anchor Text or Button Text
-	if c.checkAnchorTexts(doc) {
+	if c.checkAnchorTexts(a) {
 		score += 10
 	}
 
 	// Technique e: Structured Data (Schema.org)
-	if c.checkStructuredData(doc) {
-		score += 20
+	if c.checkStructuredData(a) {
+		score += 30
 	}
 
 	// Technique f: Analyzing Canonical Tags
-	if c.checkCanonicalTags(doc) {
+	if c.checkCanonicalTags(a) {
 		score += 10
 	}
 
-	// Technique h: Anchor Density
-	if c.checkAnchorDensity(doc) {
-		score += 5
+	// Technique i: Server-rendered state (Next.js, Nuxt, Redux globals)
+	if a.State().describesPage(urlStr) {
+		score += 20
 	}
 
-	c.logger.Debug("Product detection score", "url", urlStr, "score", score)
+	// Anchor density is a listing signal, see listingScore
 
-	// Threshold can be adjusted based on requirements
-	return score >= 50
+	c.logger.Debug("Product detection score", "url", urlStr, "score", score)
+	return score
 }
 
 func (c *Crawler) URLPatternMatch(urlStr string) bool {
@@ -72,10 +80,24 @@ func (c *Crawler) URLPatternMatch(urlStr string) bool {
 		`/buy/`,
 		`/shop/`,
 		`/product\.html`,
+		`[?&]products?_?id=`, // product_id=42, as in OpenCart and osCommerce
 	}
+	// Patterns of the domain's e-commerce platform, when detected
+	patterns = append(patterns, c.platformProfile(hostOf(urlStr)).ProductPatterns...)
+	// Configured and learned product URL templates of the domain
+	for _, template := range c.domainConfig(hostOf(urlStr)).ProductURLPatterns {
+		patterns = append(patterns, templatePattern(template))
+	}
+	patterns = append(patterns, c.learner.domainPatterns(c.domainKeyOf(hostOf(urlStr)))...)
+
+	return matchesAny(patterns, urlStr)
+}
 
+// matchesAny reports whether the lowercased URL matches any of the patterns
+func matchesAny(patterns []string, urlStr string) bool {
+	lower := strings.ToLower(urlStr)
 	for _, pattern := range patterns {
-		matched, _ := regexp.MatchString(pattern, strings.ToLower(urlStr))
+		matched, _ := regexp.MatchString(pattern, lower)
 		if matched {
 			return true
 		}
@@ -83,38 +105,30 @@ func (c *Crawler) URLPatternMatch(urlStr string) bool {
 	return false
 }
 
-func (c *Crawler) checkMetaTags(doc *goquery.Document) bool {
+func (c *Crawler) checkMetaTags(a *PageAnalysis) bool {
 	// Check for og:type product
-	ogType, exists := doc.Find("meta[property='og:type']").Attr("content")
-	if exists && strings.ToLower(ogType) == "product" {
+	if strings.ToLower(a.MetaContent("og:type")) == "product" {
 		return true
 	}
 
 	// Check for other commerce-related meta tags
-	found := false
-	doc.Find("meta").Each(func(i int, s *goquery.Selection) {
-		if name, _ := s.Attr("name"); strings.Contains(strings.ToLower(name), "product") {
-			found = true
-		}
-		if property, _ := s.Attr("property"); strings.Contains(strings.ToLower(property), "product") {
-			found = true
+	terms := c.lexiconFor(a).Meta
+	for key := range a.Meta {
+		if containsAny(key, terms) {
+			return true
 		}
-	})
+	}
 
-	return found
+	return false
 }
 
-func (c *Crawler) checkBreadcrumbs(doc *goquery.Document) bool {
-	// Look for breadcrumb navigation containing "product"
-	breadcrumbs := doc.Find(".breadcrumb, .breadcrumbs, .bc, .breadcrumb-trail")
-	if breadcrumbs.Length() == 0 {
+func (c *Crawler) checkBreadcrumbs(a *PageAnalysis) bool {
+	// Look for breadcrumb navigation containing "product" or its translation
+	if a.Breadcrumbs == "" {
 		return false
 	}
 
-	breadcrumbText := strings.ToLower(breadcrumbs.Text())
-	return strings.Contains(breadcrumbText, "product") || 
-		strings.Contains(breadcrumbText, "item") || 
-		strings.Contains(breadcrumbText, "detail")
+	return containsAny(a.Breadcrumbs, c.lexiconFor(a).Breadcrumb)
 }
 
 func (c *Crawler) checkQueryParams(urlStr string) bool {
@@ -136,71 +150,45 @@ func (c *Crawler) checkQueryParams(urlStr string) bool {
 	return false
 }
 
-func (c *Crawler) checkAnchorTexts(doc *goquery.Document) bool {
-	// Look for product-related anchor texts
-	productPhrases := []string{
-		"buy now",
-		"add to cart",
-		"add to bag",
-		"view product",
-		"product details",
-		"shop now",
-	}
-
-	found := false
-	doc.Find("a, button").Each(func(i int, s *goquery.Selection) {
-		text := strings.ToLower(strings.TrimSpace(s.Text()))
-		for _, phrase := range productPhrases {
-			if strings.Contains(text, phrase) {
-				found = true
-				return
-			}
+func (c *Crawler) checkAnchorTexts(a *PageAnalysis) bool {
+	// Look for product-related anchor texts in the page's languages
+	productPhrases := c.lexiconFor(a).CTA
+
+	for _, text := range a.CTATexts {
+		if containsAny(text, productPhrases) {
+			return true
 		}
-	})
+	}
 
-	return found
+	return false
 }
 
-func (c *Crawler) checkStructuredData(doc *goquery.Document) bool {
-	// Check for Schema.org Product markup
-	doc.Find("script[type='application/ld+json']").Each(func(i int, s *goquery.Selection) {
-		// In a real implementation, we would parse the JSON-LD and check for @type: Product
-		// This is a simplified version
-		content := strings.ToLower(s.Text())
-		if strings.Contains(content, `"@type":"product"`) || 
-			strings.Contains(content, `'@type':'product'`) {
-			return
-		}
-	})
-	return false
+func (c *Crawler) checkStructuredData(a *PageAnalysis) bool {
+	// Check for Schema.org Product markup in JSON-LD or Microdata
+	if len(findJSONLDType(a.JSONLD, "Product")) > 0 {
+		return true
+	}
+	return a.HasProductMicrodata
 }
 
-func (c *Crawler) checkCanonicalTags(doc *goquery.Document) bool {
+func (c *Crawler) checkCanonicalTags(a *PageAnalysis) bool {
 	// Check if canonical URL matches product patterns
-	canonical, exists := doc.Find("link[rel='canonical']").Attr("href")
-	if !exists {
+	if a.Canonical == "" {
 		return false
 	}
-	return c.URLPatternMatch(canonical)
+	return c.URLPatternMatch(a.Canonical)
 }
 
-func (c *Crawler) checkAnchorDensity(doc *goquery.Document) bool {
-	// Count all elements and anchor elements
-	totalElements := 0
-	anchorElements := 0
-
-	doc.Find("*").Each(func(i int, s *goquery.Selection) {
-		totalElements++
-		if goquery.NodeName(s) == "a" {
-			anchorElements++
-		}
-	})
+func (c *Crawler) checkAnchorDensity(a *PageAnalysis) bool {
+	// Element and anchor counts come from the analysis traversal
+	totalElements := a.ElementCount
+	anchorElements := a.AnchorCount
 
 	if totalElements == 0 {
 		return false
 	}
 
-	// Product pages tend to have higher anchor density
+	// Category listings tend to have higher anchor density
 	density := float64(anchorElements) / float64(totalElements)
 	return density > 0.3
 }
\ No newline at end of file
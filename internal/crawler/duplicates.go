@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"strings"
+	"sync"
+
+	"ecommerce-crawler/internal/models"
+	"ecommerce-crawler/internal/simhash"
+)
+
+const (
+	// maxDuplicateDistance is the SimHash distance, in bits, up to which
+	// two product pages count as the same page
+	maxDuplicateDistance = 3
+	// minDuplicateShingles skips pages with too little text to judge: on
+	// short texts a single changed word moves the fingerprint several bits
+	minDuplicateShingles = 100
+)
+
+// nearDuplicates indexes the text fingerprints of first-seen product
+// pages per domain, so that mirrors, print views and parameter variants
+// the URL rules missed are recorded as aliases rather than new products
+type nearDuplicates struct {
+	mu      sync.Mutex
+	indexes map[string]*simhash.Index   // domain -> fingerprints
+	pages   map[string]*productIdentity // domain|url -> identity
+	groups  map[string]bool             // domain|group id -> indexed
+}
+
+// productIdentity is what a page says it sells; pages naming different
+// products are never duplicates, however similar their templates
+type productIdentity struct {
+	name, sku, gtin string
+}
+
+func newNearDuplicates() *nearDuplicates {
+	return &nearDuplicates{
+		indexes: make(map[string]*simhash.Index),
+		pages:   make(map[string]*productIdentity),
+		groups:  make(map[string]bool),
+	}
+}
+
+func identityOf(p *models.Product) *productIdentity {
+	return &productIdentity{
+		name: strings.ToLower(strings.TrimSpace(p.Name)),
+		sku:  strings.ToLower(strings.TrimSpace(p.SKU)),
+		gtin: strings.TrimSpace(p.GTIN),
+	}
+}
+
+// conflicts reports whether the identities name different products
+func (id *productIdentity) conflicts(other *productIdentity) bool {
+	differ := func(a, b string) bool { return a != "" && b != "" && a != b }
+	return differ(id.name, other.name) || differ(id.sku, other.sku) || differ(id.gtin, other.gtin)
+}
+
+// firstSeen returns the URL of an earlier product page whose text is
+// nearly identical to this product page. Otherwise the page is indexed as
+// the first-seen page of its content and ok is false. Pages of a group
+// that is already indexed are left to variant grouping.
+func (d *nearDuplicates) firstSeen(domain, text string, p *models.Product) (string, bool) {
+	return d.match(domain, text, p, true)
+}
+
+// copyOf returns the product page a page of another type duplicates,
+// such as a print view that scored too low to count as a product
+func (d *nearDuplicates) copyOf(domain, text string, p *models.Product) (string, bool) {
+	return d.match(domain, text, p, false)
+}
+
+func (d *nearDuplicates) match(domain, text string, p *models.Product, index bool) (string, bool) {
+	fp, shingles := simhash.Fingerprint(text)
+	if shingles < minDuplicateShingles {
+		return "", false
+	}
+	identity := identityOf(p)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p.GroupID != "" && d.groups[domain+"|"+p.GroupID] {
+		return "", false
+	}
+
+	idx := d.indexes[domain]
+	if idx == nil {
+		idx = simhash.NewIndex(maxDuplicateDistance)
+		d.indexes[domain] = idx
+	}
+	for _, original := range idx.Near(fp) {
+		if original == p.URL {
+			continue
+		}
+		if known := d.pages[domain+"|"+original]; known != nil && !known.conflicts(identity) {
+			return original, true
+		}
+	}
+
+	if index {
+		idx.Add(fp, p.URL)
+		d.pages[domain+"|"+p.URL] = identity
+		d.groups[domain+"|"+p.GroupID] = true
+	}
+	return "", false
+}
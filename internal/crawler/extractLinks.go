@@ -5,41 +5,27 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
-
-	"github.com/PuerkitoBio/goquery"
 )
 
 // internal/crawler/extractLinks.go
-func (c *Crawler) extractLinks(baseURL string, content string) []string {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+// extractLinks returns the page's same-host links, resolved and
+// normalized, each tagged with the source it was first found in
+func (c *Crawler) extractLinks(a *PageAnalysis) []Link {
+	// Resolve against <base href> when the page sets one
+	base, err := a.BaseURL()
 	if err != nil {
-		c.logger.Debug("Failed to parse HTML", "url", baseURL, "error", err)
+		c.logger.Debug("Failed to parse base URL", "url", a.URL, "error", err)
 		return nil
 	}
 
-	base, err := url.Parse(baseURL)
-	if err != nil {
-		c.logger.Debug("Failed to parse base URL", "url", baseURL, "error", err)
-		return nil
-	}
+	// Links must stay inside the scope of the page's seed
+	domain := c.domainKeyOf(hostOf(a.URL))
 
-	var links []string
+	var links []Link
 	seen := make(map[string]bool)
 
-	// Extract links from <a> tags with rate limiting
-	doc.Find("a[href]").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		select {
-		case <-c.ctx.Done():
-			return false // Stop processing if context cancelled
-		default:
-		}
-
-		href, exists := s.Attr("href")
-		if !exists {
-			return true
-		}
-
-		link, err := c.processLink(base, href)
+	add := func(href string, origin LinkOrigin, text string) {
+		link, err := c.processLink(domain, base, href)
 		if err != nil {
 			// Skip logging for expected cases
 			if !errors.Is(err, ErrExternalDomain) && 
@@ -47,22 +33,39 @@ func (c *Crawler) extractLinks(baseURL string, content string) []string {
 			   !errors.Is(err, ErrNonHTMLResource) {
 				c.logger.Debug("Skipping link", "url", href, "error", err)
 			}
-			return true
+			return
 		}
 
 		normalized := c.normalizeURL(link)
 		if !seen[normalized] {
 			seen[normalized] = true
-			links = append(links, normalized)
+			links = append(links, Link{Href: normalized, Origin: origin, Text: text})
+		}
+	}
+
+	// Links from anchors, <link> tags, image maps, noscript blocks and
+	// data attributes collected during page analysis
+	for _, link := range a.Links {
+		select {
+		case <-c.ctx.Done():
+			return links // Stop processing if context cancelled
+		default:
 		}
-		return true
-	})
+		add(link.Href, link.Origin, link.Text)
+	}
+
+	// Links and product ids shipped in inline JavaScript state
+	templates := c.domainConfig(base.Host).ProductURLTemplates
+	for _, href := range a.State().candidateLinks(templates) {
+		add(href, OriginState, "")
+	}
 
 	return links
 }
 
 // processLink converts a relative link to absolute and validates it
-func (c *Crawler) processLink(base *url.URL, href string) (string, error) {
+// against the scope of the domain key
+func (c *Crawler) processLink(domain string, base *url.URL, href string) (string, error) {
     href = strings.TrimSpace(href)
     
     // Skip empty and special links
@@ -95,9 +98,9 @@ func (c *Crawler) processLink(base *url.URL, href string) (string, error) {
         return "", ErrInvalidScheme
     }
 
-    // Skip links to different domains
-    if absoluteURL.Host != base.Host {
-        c.logger.Debug("Skipping external domain", "url", absoluteURL.String(), "base", base.Host)
+    // Skip links outside the seed's scope
+    if c.domainKeyOf(absoluteURL.Host) != domain {
+        c.logger.Debug("Skipping external domain", "url", absoluteURL.String(), "domain", domain)
         return "", ErrExternalDomain
     }
 
@@ -121,32 +124,12 @@ func isNonHTMLResource(ext string) bool {
 	return nonHTMLExtensions[ext]
 }
 
-// normalizeURL standardizes URLs for comparison
+// normalizeURL returns the canonical form of the URL used for visits,
+// deduplication and output
 func (c *Crawler) normalizeURL(urlStr string) string {
-	u, err := url.Parse(urlStr)
+	normalized, err := c.canon.Canonicalize(urlStr)
 	if err != nil {
 		return strings.ToLower(urlStr)
 	}
-
-	// Standardize scheme and host
-	u.Scheme = strings.ToLower(u.Scheme)
-	u.Host = strings.ToLower(u.Host)
-
-	// Remove fragments and empty queries
-	u.Fragment = ""
-	if u.RawQuery == "" {
-		u.ForceQuery = false
-	}
-
-	// Clean path (remove duplicate slashes, etc.)
-	u.Path = strings.TrimSuffix(filepath.Clean(u.Path), "/")
-	u.Path = strings.ReplaceAll(u.Path, "\\", "/")
-
-	// Sort query parameters for consistent comparison
-	if u.RawQuery != "" {
-		query := u.Query()
-		u.RawQuery = query.Encode()
-	}
-
-	return u.String()
-}
\ No newline at end of file
+	return normalized
+}
@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"ecommerce-crawler/internal/classifier"
+)
+
+// SetModel switches product detection from the rule-based score to a
+// trained statistical model
+func (c *Crawler) SetModel(m *classifier.Model) {
+	c.model = m
+}
+
+// isProduct reports whether the page is a product. Soft 404 and
+// removed-product pages are never products.
+func (c *Crawler) isProduct(a *PageAnalysis) bool {
+	return !c.isGone(a) && c.looksLikeProduct(a)
+}
+
+// looksLikeProduct applies the trained model when one is loaded, otherwise
+// the hand-tuned score. The model's thresholds are calibrated per domain key.
+func (c *Crawler) looksLikeProduct(a *PageAnalysis) bool {
+	if c.model != nil {
+		return c.model.Predict(c.domainKeyOf(hostOf(a.URL)), c.productFeatures(a))
+	}
+	return c.productScore(a) >= productThreshold
+}
+
+// ProductFeatures returns the feature vector used by the statistical classifier
+func (c *Crawler) ProductFeatures(urlStr string, content string) map[string]float64 {
+	a := c.analyze(urlStr, content)
+	if a == nil {
+		return map[string]float64{}
+	}
+	return c.productFeatures(a)
+}
+
+func (c *Crawler) productFeatures(a *PageAnalysis) map[string]float64 {
+	features := make(map[string]float64)
+	urlStr := a.URL
+
+	// Outputs of the rule-based signals
+	signals := map[string]bool{
+		"url_pattern":     c.URLPatternMatch(urlStr),
+		"meta_tags":       c.checkMetaTags(a),
+		"breadcrumbs":     c.checkBreadcrumbs(a),
+		"query_params":    c.checkQueryParams(urlStr),
+		"anchor_texts":    c.checkAnchorTexts(a),
+		"structured_data": c.checkStructuredData(a),
+		"canonical":       c.checkCanonicalTags(a),
+		"anchor_density":  c.checkAnchorDensity(a),
+		"inline_state":    a.State().describesPage(urlStr),
+	}
+	for name, on := range signals {
+		if on {
+			features["signal:"+name] = 1
+		}
+	}
+
+	for _, token := range urlTokens(urlStr) {
+		features["url:"+token] = 1
+	}
+
+	for name := range a.Classes {
+		features["dom:class:"+name] = 1
+	}
+	for prop := range a.ItemProps {
+		features["dom:itemprop:"+prop] = 1
+	}
+
+	return features
+}
+
+// urlTokens splits the path into words, replacing numbers with shape
+// tokens so that /p/123 and /p/456 share features
+func urlTokens(urlStr string) []string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil
+	}
+
+	var tokens []string
+	words := strings.FieldsFunc(strings.ToLower(u.Path), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		tokens = append(tokens, tokenShape(word))
+	}
+	for key := range u.Query() {
+		tokens = append(tokens, "q:"+strings.ToLower(key))
+	}
+	return tokens
+}
+
+func tokenShape(word string) string {
+	digits := 0
+	for _, r := range word {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	switch {
+	case digits == 0:
+		return word
+	case digits == len(word) && digits >= 4:
+		return "#id"
+	case digits == len(word):
+		return "#num"
+	default:
+		return "#code"
+	}
+}
+
+func hostOf(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -96,47 +96,93 @@ func (h *HTTPClient) Fetch(urlStr string) (string, error) {
 	return body, nil
 }
 
+// Response is a fetched page with the headers and cookies it came with
+type Response struct {
+	URL     string // after redirects
+	Header  http.Header
+	Cookies []*http.Cookie
+	Body    string
+}
+
 func (h *HTTPClient) FetchWithContext(ctx context.Context, urlStr string) (string, error) {
+	resp, err := h.FetchResponse(ctx, urlStr)
+	if err != nil {
+		return "", err
+	}
+	return resp.Body, nil
+}
+
+// FetchResponse fetches the page and keeps the response headers and
+// cookies, which platform fingerprinting needs
+func (h *HTTPClient) FetchResponse(ctx context.Context, urlStr string) (*Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
     if err != nil {
-        return "", fmt.Errorf("%w: %v", ErrRequestFailed, err)
+        return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
     }
 
     resp, err := h.client.Do(req)
     if err != nil {
         if ctx.Err() == context.DeadlineExceeded {
-            return "", fmt.Errorf("%w: %v", ErrTimeout, err)
+            return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
         }
-        return "", fmt.Errorf("%w: %v", ErrRequestFailed, err)
+        return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
     }
     defer resp.Body.Close()
 
 
     if resp.StatusCode != http.StatusOK {
-        return "", fmt.Errorf("non-200 status code: %d", resp.StatusCode)
+        return nil, fmt.Errorf("non-200 status code: %d", resp.StatusCode)
     }
 
 	req, err = http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", h.userAgent)
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
 
 	resp, err = h.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("non-200 status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("non-200 status code: %d", resp.StatusCode)
 	}
 
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &Response{
+		URL:     resp.Request.URL.String(),
+		Header:  resp.Header,
+		Cookies: resp.Cookies(),
+		Body:    string(content),
+	}, nil
+}
+
+// Open sends a GET and returns the response unread, for bodies that are
+// streamed rather than held in memory. The caller closes the body.
+func (h *HTTPClient) Open(ctx context.Context, urlStr string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
 	}
+	req.Header.Set("User-Agent", h.userAgent)
 
-	return string(content), nil
+	resp, err := h.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("non-200 status code: %d", resp.StatusCode)
+	}
+	return resp, nil
 }
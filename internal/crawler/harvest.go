@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"sync"
+
+	"ecommerce-crawler/pkg/workerpool"
+)
+
+// HarvestPolicy controls link extraction from product pages. Carousels
+// such as "similar products" or "recently viewed" are often the only path
+// to deep catalog items, but following every link of a product page would
+// reopen the whole site graph, so only product-like links are taken and
+// harvested pages are never expanded like ordinary pages.
+type HarvestPolicy struct {
+	Enabled bool `json:"enabled"`
+	// MaxDepth is the number of product-to-product hops followed from a
+	// product reached by the normal crawl
+	MaxDepth int `json:"max_depth"`
+	// MaxPages is the number of harvested pages queued per domain
+	MaxPages int `json:"max_pages"`
+}
+
+// DefaultHarvestPolicy leaves harvesting off; enabling it follows two
+// hops and up to 500 pages per domain
+func DefaultHarvestPolicy() HarvestPolicy {
+	return HarvestPolicy{
+		Enabled:  false,
+		MaxDepth: 2,
+		MaxPages: 500,
+	}
+}
+
+// harvestBudget counts harvested pages per domain
+type harvestBudget struct {
+	mu    sync.Mutex
+	pages map[string]int
+}
+
+func newHarvestBudget() *harvestBudget {
+	return &harvestBudget{pages: make(map[string]int)}
+}
+
+// take reserves one page of the domain's budget
+func (b *harvestBudget) take(domain string, max int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pages[domain] >= max {
+		return false
+	}
+	b.pages[domain]++
+	return true
+}
+
+// release returns a reserved page that was not queued
+func (b *harvestBudget) release(domain string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pages[domain]--
+}
+
+// SetHarvestPolicy sets the product page harvesting policy for domains
+// without their own "harvest" config
+func (c *Crawler) SetHarvestPolicy(policy HarvestPolicy) {
+	c.harvestPolicy = policy
+}
+
+func (c *Crawler) harvestPolicyFor(domain string) HarvestPolicy {
+	if policy := c.domainConfig(domain).Harvest; policy != nil {
+		return *policy
+	}
+	return c.harvestPolicy
+}
+
+// harvestLinks queues the product-like links of a product page within the
+// harvest depth and budget. It reports whether any of them was new.
+func (c *Crawler) harvestLinks(task *workerpool.Task, a *PageAnalysis) bool {
+	policy := c.harvestPolicyFor(task.Domain)
+	if !policy.Enabled || task.HarvestDepth >= policy.MaxDepth {
+		return false
+	}
+
+	productive := false
+	ctaPhrases := c.lexiconFor(a).CTA
+	for _, link := range c.extractLinks(a) {
+		if link.samePage() || link.isPagination() || !c.URLPatternMatch(link.Href) {
+			continue
+		}
+		if !c.harvest.take(task.Domain, policy.MaxPages) {
+			c.logger.Debug("Harvest budget spent", "domain", task.Domain)
+			break
+		}
+		queued := c.enqueue(&workerpool.Task{
+			URL:          link.Href,
+			Depth:        task.Depth + 1,
+			Domain:       task.Domain,
+			Origin:       "harvest",
+			HarvestDepth: task.HarvestDepth + 1,
+			Priority:     c.linkPriority(link, PageTypeProduct, ctaPhrases, task.Depth+1),
+		})
+		if !queued {
+			c.harvest.release(task.Domain)
+			continue
+		}
+		productive = true
+	}
+	return productive
+}
@@ -0,0 +1,486 @@
+package crawler
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// stateMarkers are the global assignments SPA frameworks use to ship
+// server-rendered state to the browser. Nuxt 2 assigns the result of a
+// function call rather than a literal, see functionPayload.
+var stateMarkers = []string{
+	"window.__INITIAL_STATE__",
+	"window.__PRELOADED_STATE__",
+	"window.__APOLLO_STATE__",
+	"window.__NUXT__",
+	"window.__STATE__",
+	"window.__DATA__",
+}
+
+var (
+	stateLinkKeys = map[string]bool{
+		"url": true, "href": true, "link": true, "path": true,
+		"pdpurl": true, "producturl": true, "seourl": true,
+		"canonicalurl": true, "weburl": true, "shareurl": true,
+	}
+	stateIDKeys    = []string{"productId", "product_id", "styleId", "sku", "id"}
+	stateSlugKeys  = []string{"slug", "handle", "urlKey", "url_key", "seoName"}
+	stateNameKeys  = []string{"name", "title", "productName", "product_name"}
+	statePriceKeys = []string{"price", "mrp", "sellingPrice", "offerPrice", "salePrice", "finalPrice"}
+)
+
+// stateProduct is a product-like object found in inline state
+type stateProduct struct {
+	ID   string
+	Slug string
+	URL  string
+}
+
+// inlineState is what the crawler learned from a page's embedded JSON
+type inlineState struct {
+	Links    []string
+	Products []stateProduct
+}
+
+// parseInlineState collects embedded JSON blobs (Next.js, Nuxt, Redux
+// style globals and application/json scripts) and walks them for
+// product links and product-like objects
+func parseInlineState(scripts []script) *inlineState {
+	state := &inlineState{}
+	seen := make(map[string]bool)
+
+	for _, s := range scripts {
+		scriptType, id, text := s.Type, s.ID, s.Text
+
+		var blobs []string
+		switch {
+		case id == "__NEXT_DATA__" || id == "__NUXT_DATA__" || scriptType == "application/json":
+			blobs = append(blobs, text)
+		case scriptType == "" || strings.Contains(scriptType, "javascript"):
+			for _, marker := range stateMarkers {
+				if idx := strings.Index(text, marker); idx >= 0 {
+					rest := text[idx+len(marker):]
+					blob := jsonAfter(rest)
+					if blob == "" {
+						blob = functionPayload(rest)
+					}
+					if blob != "" {
+						blobs = append(blobs, blob)
+					}
+				}
+			}
+		}
+
+		for _, blob := range blobs {
+			var data interface{}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(blob)), &data); err != nil {
+				continue
+			}
+			state.walk(data, seen)
+		}
+	}
+
+	return state
+}
+
+func (s *inlineState) walk(data interface{}, seen map[string]bool) {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			s.walk(item, seen)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			if str, ok := value.(string); ok && stateLinkKeys[strings.ToLower(key)] && looksLikeLink(str) {
+				if !seen[str] {
+					seen[str] = true
+					s.Links = append(s.Links, str)
+				}
+			}
+		}
+		if p, ok := asStateProduct(v); ok {
+			s.Products = append(s.Products, p)
+		}
+		for _, value := range v {
+			s.walk(value, seen)
+		}
+	}
+}
+
+// asStateProduct recognises objects that carry an id, a name and a price
+func asStateProduct(obj map[string]interface{}) (stateProduct, bool) {
+	p := stateProduct{
+		ID:   firstStateValue(obj, stateIDKeys),
+		Slug: firstStateValue(obj, stateSlugKeys),
+	}
+	for key, value := range obj {
+		if str, ok := value.(string); ok && stateLinkKeys[strings.ToLower(key)] && looksLikeLink(str) {
+			p.URL = str
+			break
+		}
+	}
+
+	if p.ID == "" && p.Slug == "" {
+		return p, false
+	}
+	if firstStateValue(obj, stateNameKeys) == "" {
+		return p, false
+	}
+	for _, key := range statePriceKeys {
+		if _, ok := obj[key]; ok {
+			return p, true
+		}
+	}
+	return p, false
+}
+
+func firstStateValue(obj map[string]interface{}, keys []string) string {
+	for _, key := range keys {
+		if value := jsonString(obj[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func looksLikeLink(value string) bool {
+	return strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") ||
+		strings.HasPrefix(value, "http://") ||
+		strings.HasPrefix(value, "https://")
+}
+
+// candidateLinks returns the raw links from the state plus links built
+// from product ids and slugs using the domain's URL templates
+func (s *inlineState) candidateLinks(templates []string) []string {
+	links := append([]string(nil), s.Links...)
+	for _, p := range s.Products {
+		if p.URL != "" {
+			continue
+		}
+		for _, tmpl := range templates {
+			if link := expandTemplate(tmpl, p); link != "" {
+				links = append(links, link)
+			}
+		}
+	}
+	return links
+}
+
+func expandTemplate(tmpl string, p stateProduct) string {
+	if strings.Contains(tmpl, "{id}") {
+		if p.ID == "" {
+			return ""
+		}
+		tmpl = strings.ReplaceAll(tmpl, "{id}", url.PathEscape(p.ID))
+	}
+	if strings.Contains(tmpl, "{slug}") {
+		if p.Slug == "" {
+			return ""
+		}
+		tmpl = strings.ReplaceAll(tmpl, "{slug}", url.PathEscape(p.Slug))
+	}
+	return tmpl
+}
+
+// describesPage reports whether a product in the state is the page itself,
+// i.e. its id, slug or URL appears in the page URL
+func (s *inlineState) describesPage(pageURL string) bool {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return false
+	}
+	path := strings.ToLower(u.Path)
+	for _, p := range s.Products {
+		if p.URL != "" {
+			if pu, err := url.Parse(p.URL); err == nil && pu.Path != "" && strings.ToLower(pu.Path) == path {
+				return true
+			}
+		}
+		if len(p.ID) >= 4 && strings.Contains(path, strings.ToLower(p.ID)) {
+			return true
+		}
+		if len(p.Slug) >= 4 && strings.Contains(path, strings.ToLower(p.Slug)) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonAfter extracts the JSON object or array following an assignment,
+// e.g. ` = {"a": 1};` returns `{"a": 1}`
+func jsonAfter(text string) string {
+	start := strings.IndexAny(text, "{[")
+	if start < 0 || strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(text[:start]), "=")) != "" {
+		return ""
+	}
+	end := closingBracket(text, start)
+	if end < 0 {
+		return ""
+	}
+	return text[start : end+1]
+}
+
+// functionPayload extracts the state Nuxt 2 ships as a function call,
+// ` = (function(a,b){return {id:a,tags:[b]}}("42","new"))`, as JSON with
+// the call's arguments in place of the parameters
+func functionPayload(text string) string {
+	rest := strings.TrimLeft(text, "=( \t\r\n")
+	if !strings.HasPrefix(rest, "function") {
+		return ""
+	}
+	open, end := strings.IndexByte(rest, '('), strings.IndexByte(rest, ')')
+	if open < 0 || end < open {
+		return ""
+	}
+	var params []string
+	for _, p := range strings.Split(rest[open+1:end], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			params = append(params, p)
+		}
+	}
+
+	bodyStart := strings.IndexByte(rest[end:], '{')
+	if bodyStart < 0 {
+		return ""
+	}
+	bodyStart += end
+	bodyEnd := closingBracket(rest, bodyStart)
+	if bodyEnd < 0 {
+		return ""
+	}
+	body := rest[bodyStart+1 : bodyEnd]
+	ret := strings.Index(body, "return")
+	if ret < 0 {
+		return ""
+	}
+	objStart := strings.IndexAny(body[ret:], "{[")
+	if objStart < 0 {
+		return ""
+	}
+	objStart += ret
+	objEnd := closingBracket(body, objStart)
+	if objEnd < 0 {
+		return ""
+	}
+
+	// The arguments follow the body, as `}(...))` or `})(...)`
+	argsStart := strings.IndexByte(rest[bodyEnd:], '(')
+	if argsStart < 0 || strings.Trim(rest[bodyEnd+1:bodyEnd+argsStart], ") \t\r\n") != "" {
+		return ""
+	}
+	argsStart += bodyEnd
+	argsEnd := closingBracket(rest, argsStart)
+	if argsEnd < 0 {
+		return ""
+	}
+	argList, ok := jsLiteral("["+rest[argsStart+1:argsEnd]+"]", nil)
+	if !ok {
+		return ""
+	}
+	var args []json.RawMessage
+	if err := json.Unmarshal([]byte(argList), &args); err != nil {
+		return ""
+	}
+
+	vars := make(map[string]string, len(params))
+	for i, p := range params {
+		vars[p] = "null"
+		if i < len(args) {
+			vars[p] = string(args[i])
+		}
+	}
+	blob, ok := jsLiteral(body[objStart:objEnd+1], vars)
+	if !ok {
+		return ""
+	}
+	return blob
+}
+
+// closingBracket returns the index of the bracket closing the one at
+// start, skipping quoted strings, or -1
+func closingBracket(text string, start int) int {
+	depth := 0
+	var quote byte
+	escaped := false
+	for i := start; i < len(text); i++ {
+		ch := text[i]
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '"', '\'':
+			quote = ch
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// jsLiteral converts a JavaScript object or array literal to JSON. Keys
+// are quoted, strings re-encoded, `void 0` and undefined become null,
+// `!0` and `!1` booleans, and identifiers take their JSON value from vars.
+// Anything else, such as a function call, fails the conversion.
+func jsLiteral(src string, vars map[string]string) (string, bool) {
+	var out strings.Builder
+	var open []byte // enclosing '{' and '['
+	key := false    // the next token is an object key
+
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			i++
+		case ch == '{' || ch == '[':
+			open = append(open, ch)
+			out.WriteByte(ch)
+			key = ch == '{'
+			i++
+		case ch == '}' || ch == ']':
+			if len(open) == 0 {
+				return "", false
+			}
+			open = open[:len(open)-1]
+			out.WriteByte(ch)
+			key = false
+			i++
+		case ch == ',':
+			out.WriteByte(ch)
+			key = len(open) > 0 && open[len(open)-1] == '{'
+			i++
+		case ch == ':':
+			out.WriteByte(ch)
+			key = false
+			i++
+		case ch == '"' || ch == '\'':
+			end, value, ok := jsString(src, i)
+			if !ok {
+				return "", false
+			}
+			encoded, _ := json.Marshal(value)
+			out.Write(encoded)
+			i = end
+		case ch == '!' && i+1 < len(src) && (src[i+1] == '0' || src[i+1] == '1'):
+			out.WriteString(strconv.FormatBool(src[i+1] == '0'))
+			i += 2
+		case ch == '-' || ch == '.' || isDigit(ch):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				j++
+			}
+			number := src[i:j]
+			if key {
+				encoded, _ := json.Marshal(number)
+				out.Write(encoded)
+			} else {
+				// JSON needs a digit before the point
+				if strings.HasPrefix(number, ".") {
+					number = "0" + number
+				} else if strings.HasPrefix(number, "-.") {
+					number = "-0" + number[1:]
+				}
+				out.WriteString(number)
+			}
+			i = j
+		case isIdentStart(ch):
+			j := i + 1
+			for j < len(src) && (isIdentStart(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			word := src[i:j]
+			i = j
+			if key {
+				encoded, _ := json.Marshal(word)
+				out.Write(encoded)
+				continue
+			}
+			switch word {
+			case "true", "false", "null":
+				out.WriteString(word)
+			case "undefined":
+				out.WriteString("null")
+			case "void":
+				// void 0
+				for i < len(src) && (src[i] == ' ' || isDigit(src[i])) {
+					i++
+				}
+				out.WriteString("null")
+			default:
+				value, ok := vars[word]
+				if !ok {
+					return "", false
+				}
+				out.WriteString(value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return out.String(), len(open) == 0
+}
+
+// jsString decodes the single- or double-quoted string at start and
+// returns the index after its closing quote
+func jsString(src string, start int) (int, string, bool) {
+	quote := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		ch := src[i]
+		if ch == quote {
+			return i + 1, b.String(), true
+		}
+		if ch != '\\' || i+1 == len(src) {
+			b.WriteByte(ch)
+			continue
+		}
+		i++
+		switch src[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u', 'x':
+			size := 4
+			if src[i] == 'x' {
+				size = 2
+			}
+			if i+size >= len(src) {
+				return 0, "", false
+			}
+			r, err := strconv.ParseUint(src[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return 0, "", false
+			}
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return 0, "", false
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch byte) bool {
+	return ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
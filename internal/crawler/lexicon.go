@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed lexicons/*.json
+var embeddedLexicons embed.FS
+
+// Lexicon holds the commerce phrases of one language, all lowercase
+type Lexicon struct {
+	CTA        []string `json:"cta"`        // Button and link texts: "add to cart", ...
+	Breadcrumb []string `json:"breadcrumb"` // Breadcrumb words: "product", ...
+	Meta       []string `json:"meta"`       // Words in commerce meta tag names
+	NotFound   []string `json:"not_found"`  // Soft 404 and removed-product phrases
+}
+
+// merge appends other's phrases to the lexicon
+func (l Lexicon) merge(other Lexicon) Lexicon {
+	return Lexicon{
+		CTA:        append(append([]string(nil), l.CTA...), other.CTA...),
+		Breadcrumb: append(append([]string(nil), l.Breadcrumb...), other.Breadcrumb...),
+		Meta:       append(append([]string(nil), l.Meta...), other.Meta...),
+		NotFound:   append(append([]string(nil), l.NotFound...), other.NotFound...),
+	}
+}
+
+// defaultLexicons loads the lexicons embedded in the binary
+func defaultLexicons() map[string]Lexicon {
+	lexicons := make(map[string]Lexicon)
+	entries, err := embeddedLexicons.ReadDir("lexicons")
+	if err != nil {
+		return lexicons
+	}
+	for _, entry := range entries {
+		data, err := embeddedLexicons.ReadFile("lexicons/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		var lex Lexicon
+		if err := json.Unmarshal(data, &lex); err != nil {
+			continue
+		}
+		lexicons[strings.TrimSuffix(entry.Name(), ".json")] = normalizeLexicon(lex)
+	}
+	return lexicons
+}
+
+// LoadLexicons reads <lang>.json lexicon files from a directory
+func LoadLexicons(dir string) (map[string]Lexicon, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	lexicons := make(map[string]Lexicon)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lexicon: %w", err)
+		}
+		var lex Lexicon
+		if err := json.Unmarshal(data, &lex); err != nil {
+			return nil, fmt.Errorf("failed to parse lexicon %s: %w", file, err)
+		}
+		lexicons[strings.TrimSuffix(filepath.Base(file), ".json")] = normalizeLexicon(lex)
+	}
+	return lexicons, nil
+}
+
+// SetLexicon adds or replaces the lexicon for a language code such as "hi"
+func (c *Crawler) SetLexicon(lang string, lex Lexicon) {
+	c.lexicons[strings.ToLower(lang)] = normalizeLexicon(lex)
+}
+
+func normalizeLexicon(lex Lexicon) Lexicon {
+	lower := func(phrases []string) []string {
+		out := make([]string, 0, len(phrases))
+		for _, p := range phrases {
+			if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	return Lexicon{
+		CTA:        lower(lex.CTA),
+		Breadcrumb: lower(lex.Breadcrumb),
+		Meta:       lower(lex.Meta),
+		NotFound:   lower(lex.NotFound),
+	}
+}
+
+// lexiconFor returns English plus the page's language, taken from the
+// html lang attribute and the domain config
+func (c *Crawler) lexiconFor(a *PageAnalysis) Lexicon {
+	lex := c.lexicons["en"]
+	seen := map[string]bool{"en": true}
+
+	for _, lang := range []string{a.Lang, c.domainConfig(hostOf(a.URL)).Language} {
+		lang = baseLanguage(lang)
+		if lang == "" || seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		if extra, ok := c.lexicons[lang]; ok {
+			lex = lex.merge(extra)
+		}
+	}
+	return lex
+}
+
+// baseLanguage reduces "hi-IN" or "es_ES" to "hi" or "es"
+func baseLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
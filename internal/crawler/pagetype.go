@@ -0,0 +1,322 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageType is the role a page plays within a storefront
+type PageType int
+
+const (
+	PageTypeUnknown PageType = iota
+	PageTypeProduct
+	PageTypeListing
+	PageTypeSearch
+	PageTypeAccount
+	PageTypeContent
+	PageTypeGone
+)
+
+func (t PageType) String() string {
+	switch t {
+	case PageTypeProduct:
+		return "product"
+	case PageTypeListing:
+		return "listing"
+	case PageTypeSearch:
+		return "search"
+	case PageTypeAccount:
+		return "account"
+	case PageTypeContent:
+		return "content"
+	case PageTypeGone:
+		return "gone"
+	default:
+		return "unknown"
+	}
+}
+
+// PagePolicy controls how the crawler treats a page of a given type
+type PagePolicy struct {
+	Fetch       bool          // Fetch URLs of this type at all
+	Expand      bool          // Extract and queue links from the page
+	IgnoreDepth bool          // Follow product and pagination links past max depth
+	MinInterval time.Duration // Minimum gap between fetches of this type per domain
+}
+
+func defaultPagePolicies() map[PageType]PagePolicy {
+	return map[PageType]PagePolicy{
+		PageTypeUnknown: {Fetch: true, Expand: true},
+		PageTypeProduct: {Fetch: true, Expand: false},
+		PageTypeListing: {Fetch: true, Expand: true, IgnoreDepth: true},
+		PageTypeSearch:  {Fetch: true, Expand: true, MinInterval: 5 * time.Second},
+		PageTypeAccount: {Fetch: false, Expand: false},
+		PageTypeContent: {Fetch: true, Expand: true},
+		PageTypeGone:    {Fetch: true, Expand: false},
+	}
+}
+
+// maxDepthOverrun is how many levels past maxDepth a page type that
+// ignores depth may follow product and pagination links
+const maxDepthOverrun = 2
+
+// beyondMaxDepth reports whether a link past maxDepth is still followed:
+// only product-like and pagination links of pages ignoring depth, and
+// never more than maxDepthOverrun levels deep. Past maxDepth pagination
+// counts as a level, so listing chains end too.
+func (c *Crawler) beyondMaxDepth(policy PagePolicy, link Link, depth int) bool {
+	if !policy.IgnoreDepth || depth > c.maxDepth+maxDepthOverrun {
+		return false
+	}
+	return link.isPagination() || c.URLPatternMatch(link.Href)
+}
+
+// SetPagePolicy overrides the crawl policy for a page type
+func (c *Crawler) SetPagePolicy(t PageType, p PagePolicy) {
+	c.pagePolicies[t] = p
+}
+
+func (c *Crawler) pagePolicy(t PageType) PagePolicy {
+	if p, ok := c.pagePolicies[t]; ok {
+		return p
+	}
+	return c.pagePolicies[PageTypeUnknown]
+}
+
+var (
+	accountSegments = map[string]bool{
+		"cart": true, "basket": true, "bag": true, "checkout": true,
+		"account": true, "my-account": true, "myaccount": true,
+		"login": true, "signin": true, "sign-in": true, "logout": true,
+		"register": true, "signup": true, "sign-up": true,
+		"wishlist": true, "orders": true, "password": true,
+	}
+	searchSegments = map[string]bool{
+		"search": true, "searchresults": true, "search-results": true,
+	}
+	searchParams    = []string{"q", "query", "text", "search", "searchterm", "keyword", "keywords"}
+	contentSegments = map[string]bool{
+		"blog": true, "blogs": true, "article": true, "articles": true,
+		"news": true, "about": true, "about-us": true, "help": true,
+		"faq": true, "faqs": true, "contact": true, "contact-us": true,
+		"careers": true, "policy": true, "policies": true, "privacy": true,
+		"terms": true, "pages": true, "stores": true, "store-locator": true,
+	}
+	listingPatterns = []string{
+		`/category/`,
+		`/categories/`,
+		`/c/`,
+		`/collections?/`,
+		`/catalog/`,
+		`/department/`,
+		`/browse/`,
+	}
+)
+
+// classifyURL guesses the page type from the URL alone, so that pages
+// which should never be fetched can be skipped before the request
+func (c *Crawler) classifyURL(urlStr string) PageType {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return PageTypeUnknown
+	}
+
+	segments := strings.Split(strings.ToLower(strings.Trim(u.Path, "/")), "/")
+	for _, seg := range segments {
+		if accountSegments[seg] {
+			return PageTypeAccount
+		}
+	}
+	for _, seg := range segments {
+		if searchSegments[seg] {
+			return PageTypeSearch
+		}
+	}
+	query := u.Query()
+	for _, param := range searchParams {
+		if query.Get(param) != "" {
+			return PageTypeSearch
+		}
+	}
+	return PageTypeUnknown
+}
+
+// ClassifyPage assigns the page to one of the known page types
+func (c *Crawler) ClassifyPage(urlStr string, content string) PageType {
+	if t := c.classifyURL(urlStr); t != PageTypeUnknown {
+		return t
+	}
+
+	a := c.analyze(urlStr, content)
+	if a == nil {
+		return PageTypeUnknown
+	}
+	return c.classify(a)
+}
+
+// classify assigns an analysed page to one of the known page types
+func (c *Crawler) classify(a *PageAnalysis) PageType {
+	if t := c.classifyURL(a.URL); t != PageTypeUnknown {
+		return t
+	}
+	if c.isGone(a) {
+		return PageTypeGone
+	}
+	if c.looksLikeProduct(a) {
+		return PageTypeProduct
+	}
+	if c.listingScore(a) >= listingThreshold {
+		return PageTypeListing
+	}
+	if c.isContentPage(a) {
+		return PageTypeContent
+	}
+	return PageTypeUnknown
+}
+
+const listingThreshold = 30
+
+func (c *Crawler) listingScore(a *PageAnalysis) int {
+	score := 0
+	urlStr := a.URL
+
+	if matchesAny(listingPatterns, urlStr) {
+		score += 20
+	}
+
+	// Link-heavy pages are usually category listings
+	if c.checkAnchorDensity(a) {
+		score += 15
+	}
+
+	// Several tiles linking to product-looking URLs
+	productLinks := 0
+	for _, anchor := range a.Anchors {
+		if c.URLPatternMatch(anchor.Href) {
+			productLinks++
+		}
+	}
+	if productLinks >= 4 {
+		score += 20
+	}
+
+	if c.checkPagination(a) {
+		score += 10
+	}
+
+	if len(findJSONLDType(a.JSONLD, "ItemList")) > 0 || len(findJSONLDType(a.JSONLD, "CollectionPage")) > 0 {
+		score += 15
+	}
+
+	c.logger.Debug("Listing detection score", "url", urlStr, "score", score)
+	return score
+}
+
+func (c *Crawler) checkPagination(a *PageAnalysis) bool {
+	if a.HasPagination {
+		return true
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil {
+		return false
+	}
+	return u.Query().Get("page") != "" || u.Query().Get("p") != ""
+}
+
+func (c *Crawler) isContentPage(a *PageAnalysis) bool {
+	if strings.ToLower(a.MetaContent("og:type")) == "article" {
+		return true
+	}
+
+	u, err := url.Parse(a.URL)
+	if err != nil {
+		return false
+	}
+	for _, seg := range strings.Split(strings.ToLower(strings.Trim(u.Path, "/")), "/") {
+		if contentSegments[seg] {
+			return true
+		}
+	}
+	return false
+}
+
+// typeThrottle spaces out fetches of rate-limited page types per domain.
+// A page that has to wait holds a reserved slot instead of a worker.
+type typeThrottle struct {
+	mu    sync.Mutex
+	next  map[string]time.Time // domain|type -> next free slot
+	slots map[string]time.Time // URL -> slot reserved for it
+}
+
+func newTypeThrottle() *typeThrottle {
+	return &typeThrottle{
+		next:  make(map[string]time.Time),
+		slots: make(map[string]time.Time),
+	}
+}
+
+// reserve returns how long the URL must wait before it may be fetched as
+// a page of the given type. A URL that has to wait keeps its slot, so
+// fetching it again once the wait is over goes through at once.
+func (t *typeThrottle) reserve(domain, urlStr string, pageType PageType, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if slot, ok := t.slots[urlStr]; ok {
+		delete(t.slots, urlStr)
+		if slot.After(now) {
+			return slot.Sub(now)
+		}
+		return 0
+	}
+
+	if slot := t.take(domain, pageType, interval, now); slot.After(now) {
+		t.slots[urlStr] = slot
+		return slot.Sub(now)
+	}
+	return 0
+}
+
+// wait blocks until the domain may fetch another page of the given type,
+// or until the context is done
+func (t *typeThrottle) wait(ctx context.Context, domain string, pageType PageType, interval time.Duration) error {
+	if interval <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	slot := t.take(domain, pageType, interval, now)
+	t.mu.Unlock()
+	if !slot.After(now) {
+		return nil
+	}
+
+	timer := time.NewTimer(slot.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// take books the next free slot of the page type; t.mu must be held
+func (t *typeThrottle) take(domain string, pageType PageType, interval time.Duration, now time.Time) time.Time {
+	key := domain + "|" + pageType.String()
+	slot := t.next[key]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next[key] = slot.Add(interval)
+	return slot
+}
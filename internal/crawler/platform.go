@@ -0,0 +1,209 @@
+package crawler
+
+import (
+	"strings"
+)
+
+// Platform is the e-commerce software a domain runs on
+type Platform string
+
+const (
+	PlatformCustom      Platform = "custom"
+	PlatformShopify     Platform = "shopify"
+	PlatformMagento     Platform = "magento"
+	PlatformWooCommerce Platform = "woocommerce"
+	PlatformSFCC        Platform = "salesforce-commerce-cloud"
+	PlatformBigCommerce Platform = "bigcommerce"
+)
+
+// platformSignals are the fingerprints a platform leaves in a response.
+// All values are lowercase substrings.
+type platformSignals struct {
+	Headers    []string // header names
+	PoweredBy  []string // Powered-By and X-Powered-By header values
+	Cookies    []string // cookie name prefixes
+	Scripts    []string // script src paths
+	Generators []string // <meta name="generator"> content
+}
+
+// platformProfile is what the crawler switches on once a platform is known
+type platformProfile struct {
+	ProductPatterns []string // URL regexes of product pages
+	VariantParams   []string // variant query params, "prefix_*" for prefixes
+	Sitemaps        []string // product sitemap paths
+}
+
+// platformOrder decides ties between platforms with equal evidence
+var platformOrder = []Platform{
+	PlatformShopify,
+	PlatformMagento,
+	PlatformWooCommerce,
+	PlatformSFCC,
+	PlatformBigCommerce,
+}
+
+var platformFingerprints = map[Platform]platformSignals{
+	PlatformShopify: {
+		Headers:    []string{"x-shopid", "x-shopify-stage", "x-sorting-hat-shopid", "x-shardid"},
+		PoweredBy:  []string{"shopify"},
+		Cookies:    []string{"_shopify_", "cart_sig", "secure_customer_sig"},
+		Scripts:    []string{"cdn.shopify.com", "/cdn/shop/", "shopifycloud"},
+		Generators: []string{"shopify"},
+	},
+	PlatformMagento: {
+		Headers:    []string{"x-magento-cache-debug", "x-magento-tags", "x-magento-cache-control"},
+		Cookies:    []string{"x-magento-vary", "mage-cache-", "mage-messages", "mage-translation"},
+		Scripts:    []string{"/static/version", "requirejs/require.js", "/mage/", "/skin/frontend/"},
+		Generators: []string{"magento"},
+	},
+	PlatformWooCommerce: {
+		Cookies:    []string{"woocommerce_", "wp_woocommerce_session_"},
+		Scripts:    []string{"/wp-content/plugins/woocommerce/"},
+		Generators: []string{"woocommerce"},
+	},
+	PlatformSFCC: {
+		Headers: []string{"x-dw-request-base-id"},
+		Cookies: []string{"dwsid", "dwanonymous_", "dwsecuretoken_", "dw_dnt", "__cq_dnt"},
+		Scripts: []string{"/on/demandware.static/", "demandware.edgesuite.net", "demandware.net"},
+	},
+	PlatformBigCommerce: {
+		Headers:    []string{"x-bc-"},
+		Cookies:    []string{"shop_session_token", "fornax_anonymousid", "sf-csrf-token"},
+		Scripts:    []string{"cdn11.bigcommerce.com", "bigcommerce.com/s-", "/stencil/"},
+		Generators: []string{"bigcommerce"},
+	},
+}
+
+var platformProfiles = map[Platform]platformProfile{
+	PlatformShopify: {
+		ProductPatterns: []string{`/products/[^/?#]+`},
+		VariantParams:   []string{"variant"},
+		Sitemaps:        []string{"/sitemap_products_1.xml"},
+	},
+	PlatformMagento: {
+		ProductPatterns: []string{`/catalog/product/view/`},
+		Sitemaps:        []string{"/pub/sitemap.xml", "/media/sitemap.xml"},
+	},
+	PlatformWooCommerce: {
+		ProductPatterns: []string{`/product/[^/?#]+`, `[?&]product=`},
+		VariantParams:   []string{"attribute_*"},
+		Sitemaps:        []string{"/product-sitemap.xml", "/wp-sitemap-posts-product-1.xml"},
+	},
+	PlatformSFCC: {
+		ProductPatterns: []string{`/\d{5,}\.html`, `product-show`, `[?&]pid=`},
+		VariantParams:   []string{"dwvar_*", "quantity"},
+		Sitemaps:        []string{"/sitemap_0-product.xml"},
+	},
+	PlatformBigCommerce: {
+		ProductPatterns: []string{`/products\.php\?product=`},
+		Sitemaps:        []string{"/xmlsitemap.php?type=products&page=1"},
+	},
+}
+
+// DetectPlatform fingerprints a fetched page
+func DetectPlatform(resp *Response) Platform {
+	a, err := AnalyzePage(resp.URL, resp.Body)
+	if err != nil {
+		return PlatformCustom
+	}
+	return detectPlatform(resp, a)
+}
+
+// detectPlatform counts the matching signals of every platform. Headers
+// and generator tags are set by the platform itself and count double.
+func detectPlatform(resp *Response, a *PageAnalysis) Platform {
+	var headers, cookies []string
+	for name := range resp.Header {
+		headers = append(headers, strings.ToLower(name))
+	}
+	for _, cookie := range resp.Cookies {
+		cookies = append(cookies, strings.ToLower(cookie.Name))
+	}
+	poweredBy := strings.ToLower(resp.Header.Get("Powered-By") + " " + resp.Header.Get("X-Powered-By"))
+
+	var scripts []string
+	for _, src := range a.ScriptSrcs {
+		scripts = append(scripts, strings.ToLower(src))
+	}
+	generator := strings.ToLower(strings.Join(a.Meta["generator"], " "))
+
+	best, bestScore := PlatformCustom, 0
+	for _, platform := range platformOrder {
+		signals := platformFingerprints[platform]
+		score := 0
+		if anyHasPrefix(headers, signals.Headers) || containsAny(poweredBy, signals.PoweredBy) {
+			score += 2
+		}
+		if anyHasPrefix(cookies, signals.Cookies) {
+			score++
+		}
+		if anyContains(scripts, signals.Scripts) {
+			score++
+		}
+		if generator != "" && containsAny(generator, signals.Generators) {
+			score += 2
+		}
+		if score > bestScore {
+			best, bestScore = platform, score
+		}
+	}
+	return best
+}
+
+func anyHasPrefix(values, prefixes []string) bool {
+	for _, v := range values {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(v, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyContains(values, substrings []string) bool {
+	for _, v := range values {
+		if containsAny(v, substrings) {
+			return true
+		}
+	}
+	return false
+}
+
+// notePlatform fingerprints pages of a domain until a platform is found
+func (c *Crawler) notePlatform(domain string, resp *Response, a *PageAnalysis) {
+	domain = c.domainKeyOf(domain)
+	if c.platform(domain) != PlatformCustom {
+		return
+	}
+	if platform := detectPlatform(resp, a); platform != PlatformCustom {
+		c.platforms.Store(domain, platform)
+		c.logger.Info("Detected e-commerce platform", "domain", domain, "platform", platform)
+	}
+}
+
+// SetPlatform fixes the platform of a domain instead of detecting it
+func (c *Crawler) SetPlatform(domain string, platform Platform) {
+	c.platforms.Store(c.domainKeyOf(domain), platform)
+}
+
+func (c *Crawler) platform(domain string) Platform {
+	if value, ok := c.platforms.Load(c.domainKeyOf(domain)); ok {
+		return value.(Platform)
+	}
+	return PlatformCustom
+}
+
+func (c *Crawler) platformProfile(domain string) platformProfile {
+	return platformProfiles[c.platform(domain)]
+}
+
+// GetPlatforms returns the platform of every domain where one was detected
+func (c *Crawler) GetPlatforms() map[string]Platform {
+	result := make(map[string]Platform)
+	c.platforms.Range(func(key, value interface{}) bool {
+		result[key.(string)] = value.(Platform)
+		return true
+	})
+	return result
+}
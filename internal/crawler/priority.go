@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"ecommerce-crawler/pkg/workerpool"
+)
+
+// Base priorities of tasks that do not come from page links. The frontier
+// pops the highest priority first, so seeds and structured sources run
+// before ordinary links.
+const (
+	prioritySeed    = 100
+	priorityCatalog = 50
+	prioritySitemap = 40
+)
+
+// linkPriority scores a link found on a page. Product-like URLs and
+// product CTAs go first, listings and pagination next, and content,
+// search and deep links last.
+func (c *Crawler) linkPriority(link Link, parent PageType, ctaPhrases []string, depth int) float64 {
+	score := 0.0
+	if c.URLPatternMatch(link.Href) {
+		score += 30
+	}
+	if link.Text != "" && containsAny(link.Text, ctaPhrases) {
+		score += 10
+	}
+
+	switch {
+	case link.isPagination():
+		score += 20
+	case link.samePage():
+		score += 5
+	case link.Origin == OriginState || link.Origin == OriginData:
+		// Script and data links are usually product tiles
+		score += 5
+	}
+
+	switch parent {
+	case PageTypeListing:
+		score += 10
+	case PageTypeContent:
+		score -= 10
+	}
+	if c.classifyURL(link.Href) == PageTypeSearch {
+		score -= 10
+	}
+
+	return score - float64(depth)
+}
+
+// enqueue adds the task to the frontier unless its URL was queued or
+// fetched before, or lies outside the scope of the task's seed
+func (c *Crawler) enqueue(task *workerpool.Task) bool {
+	task.URL = c.normalizeURL(task.URL)
+	if c.domainKeyOf(hostOf(task.URL)) != task.Domain {
+		c.logger.Debug("Skipping URL outside the seed's scope", "url", task.URL, "domain", task.Domain)
+		return false
+	}
+	return c.workerPool.AddTask(task)
+}
+
+// requeue adds the task to the frontier even though its URL is already in
+// the visited set, such as a seed of a resumed crawl
+func (c *Crawler) requeue(task *workerpool.Task) bool {
+	task.URL = c.normalizeURL(task.URL)
+	c.readmit.Store(task.URL, struct{}{})
+	if !c.workerPool.AddTask(task) {
+		c.readmit.Delete(task.URL)
+		return false
+	}
+	return true
+}
+
+// admit is the frontier's dedupe check. The visited set holds every URL
+// queued or fetched, so a URL is queued once unless it is requeued.
+func (c *Crawler) admit(urlStr string) bool {
+	if _, ok := c.readmit.LoadAndDelete(urlStr); ok {
+		c.visitedURLs.Add(urlStr)
+		return true
+	}
+	return c.visitedURLs.Add(urlStr)
+}
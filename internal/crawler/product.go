@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"strings"
+
+	"ecommerce-crawler/internal/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ExtractProduct builds a product record from the page's structured data
+func (c *Crawler) ExtractProduct(urlStr string, content string) *models.Product {
+	a := c.analyze(urlStr, content)
+	if a == nil {
+		return &models.Product{URL: urlStr}
+	}
+	return c.extractProduct(a)
+}
+
+// extractProduct fills the record from the most to the least reliable
+// source; a field set by an earlier source is never overwritten
+func (c *Crawler) extractProduct(a *PageAnalysis) *models.Product {
+	p := &models.Product{URL: a.URL}
+
+	fromJSONLD(p, a.JSONLD)
+	if a.HasProductMicrodata {
+		fromMicrodata(p, a.Doc)
+	}
+	fromOpenGraph(p, a)
+	fromMetaTags(p, a)
+
+	return p
+}
+
+func fromJSONLD(p *models.Product, nodes []map[string]interface{}) {
+	for _, node := range findJSONLDType(nodes, "Product") {
+		setField(&p.Name, jsonString(node["name"]))
+		setField(&p.Brand, jsonString(node["brand"]))
+		setField(&p.SKU, jsonString(node["sku"]))
+		for _, key := range []string{"gtin", "gtin13", "gtin12", "gtin14", "gtin8"} {
+			setField(&p.GTIN, jsonString(node[key]))
+		}
+		setField(&p.Description, jsonString(node["description"]))
+		addImages(p, jsonStrings(node["image"])...)
+
+		for _, offer := range jsonObjects(node["offers"]) {
+			price := jsonString(offer["price"])
+			if price == "" {
+				price = jsonString(offer["lowPrice"])
+			}
+			setField(&p.Price, price)
+			setField(&p.Currency, jsonString(offer["priceCurrency"]))
+			setField(&p.Availability, availabilityName(jsonString(offer["availability"])))
+		}
+	}
+}
+
+func fromMicrodata(p *models.Product, doc *goquery.Document) {
+	doc.Find("[itemtype*='schema.org/Product']").Each(func(i int, scope *goquery.Selection) {
+		setField(&p.Name, itemprop(scope, "name"))
+		setField(&p.Brand, itemprop(scope, "brand"))
+		setField(&p.SKU, itemprop(scope, "sku"))
+		for _, key := range []string{"gtin", "gtin13", "gtin12", "gtin14", "gtin8"} {
+			setField(&p.GTIN, itemprop(scope, key))
+		}
+		setField(&p.Price, itemprop(scope, "price"))
+		setField(&p.Currency, itemprop(scope, "priceCurrency"))
+		setField(&p.Availability, availabilityName(itemprop(scope, "availability")))
+		setField(&p.Description, itemprop(scope, "description"))
+
+		scope.Find("[itemprop='image']").Each(func(i int, s *goquery.Selection) {
+			addImages(p, itempropValue(s))
+		})
+	})
+}
+
+func fromOpenGraph(p *models.Product, a *PageAnalysis) {
+	setField(&p.Name, a.MetaContent("og:title"))
+	setField(&p.Brand, a.MetaContent("product:brand"))
+	setField(&p.SKU, a.MetaContent("product:retailer_item_id"))
+	setField(&p.GTIN, a.MetaContent("product:upc"))
+	setField(&p.GTIN, a.MetaContent("product:ean"))
+	setField(&p.Price, a.MetaContent("product:price:amount"))
+	setField(&p.Price, a.MetaContent("og:price:amount"))
+	setField(&p.Currency, a.MetaContent("product:price:currency"))
+	setField(&p.Currency, a.MetaContent("og:price:currency"))
+	setField(&p.Availability, availabilityName(a.MetaContent("product:availability")))
+	setField(&p.Description, a.MetaContent("og:description"))
+	addImages(p, a.Meta["og:image"]...)
+}
+
+func fromMetaTags(p *models.Product, a *PageAnalysis) {
+	setField(&p.Name, a.MetaContent("twitter:title"))
+	setField(&p.Description, a.MetaContent("description"))
+	setField(&p.Description, a.MetaContent("twitter:description"))
+	addImages(p, a.MetaContent("twitter:image"))
+	setField(&p.Name, a.Title)
+}
+
+func setField(field *string, value string) {
+	if *field == "" {
+		*field = strings.TrimSpace(value)
+	}
+}
+
+func addImages(p *models.Product, images ...string) {
+	for _, image := range images {
+		image = strings.TrimSpace(image)
+		if image == "" {
+			continue
+		}
+		duplicate := false
+		for _, existing := range p.Images {
+			if existing == image {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			p.Images = append(p.Images, image)
+		}
+	}
+}
+
+// availabilityName reduces "https://schema.org/InStock" and similar to "InStock"
+func availabilityName(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndex(value, "/"); i >= 0 {
+		value = value[i+1:]
+	}
+	return value
+}
+
+// jsonObjects reads an offers-style value that may be an object or a list
+func jsonObjects(value interface{}) []map[string]interface{} {
+	var out []map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out = append(out, v)
+		// AggregateOffer nests the individual offers
+		out = append(out, jsonObjects(v["offers"])...)
+	case []interface{}:
+		for _, item := range v {
+			out = append(out, jsonObjects(item)...)
+		}
+	}
+	return out
+}
+
+// itemprop returns the value of the first matching Microdata property
+func itemprop(scope *goquery.Selection, name string) string {
+	s := scope.Find("[itemprop='" + name + "']").First()
+	if s.Length() == 0 {
+		return ""
+	}
+	// Nested items such as brand carry their own name property
+	if _, nested := s.Attr("itemscope"); nested {
+		if inner := itemprop(s, "name"); inner != "" {
+			return inner
+		}
+	}
+	return itempropValue(s)
+}
+
+func itempropValue(s *goquery.Selection) string {
+	for _, attr := range []string{"content", "href", "src"} {
+		if value, ok := s.Attr(attr); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return strings.TrimSpace(s.Text())
+}
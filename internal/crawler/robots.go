@@ -4,30 +4,75 @@ import (
 	"ecommerce-crawler/pkg/workerpool"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/temoto/robotstxt"
 )
 
-func (c *Crawler) checkRobotsTxt(task *workerpool.Task) (bool, time.Duration, error) {
-	// Get robots.txt URL
-	robotsURL, err := url.Parse(task.URL)
+// robotsCache holds the parsed robots.txt of each host, fetched once
+type robotsCache struct {
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry // scheme://host -> entry
+}
+
+type robotsEntry struct {
+	once sync.Once
+	data *robotstxt.RobotsData // nil when the host has none
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{hosts: make(map[string]*robotsEntry)}
+}
+
+// robotsFor returns the robots.txt of the URL's host, fetching it on the
+// first request for the host; nil means everything is allowed
+func (c *Crawler) robotsFor(u *url.URL) *robotstxt.RobotsData {
+	key := u.Scheme + "://" + u.Host
+
+	c.robots.mu.Lock()
+	entry := c.robots.hosts[key]
+	if entry == nil {
+		entry = &robotsEntry{}
+		c.robots.hosts[key] = entry
+	}
+	c.robots.mu.Unlock()
+
+	entry.once.Do(func() { entry.data = c.fetchRobots(key + "/robots.txt") })
+	return entry.data
+}
+
+func (c *Crawler) fetchRobots(robotsURL string) *robotstxt.RobotsData {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", robotsURL, nil)
 	if err != nil {
-		return false, c.crawlDelay, err
+		return nil
 	}
-	robotsURL.Path = "/robots.txt"
+	req.Header.Set("User-Agent", c.httpClient.userAgent)
 
-	// Fetch robots.txt
-	resp, err := http.Get(robotsURL.String())
+	resp, err := c.httpClient.client.Do(req)
 	if err != nil {
 		// If robots.txt doesn't exist, assume all paths are allowed
-		return true, c.crawlDelay, nil
+		return nil
 	}
 	defer resp.Body.Close()
 
-	// Parse robots.txt
 	data, err := robotstxt.FromResponse(resp)
 	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (c *Crawler) checkRobotsTxt(task *workerpool.Task) (bool, time.Duration, error) {
+	// Get robots.txt URL
+	pageURL, err := url.Parse(task.URL)
+	if err != nil {
+		return false, c.crawlDelay, err
+	}
+
+	// Fetched once per host
+	data := c.robotsFor(pageURL)
+	if data == nil {
 		return true, c.crawlDelay, nil
 	}
 
@@ -38,8 +83,8 @@ func (c *Crawler) checkRobotsTxt(task *workerpool.Task) (bool, time.Duration, er
 		return true, c.crawlDelay, nil
 	}
 
-	// Check if the path is allowed
-	allowed := group.Test(task.URL)
+	// Check if the path is allowed; rules match the path and query
+	allowed := group.Test(pageURL.RequestURI())
 	if !allowed {
 		return false, c.crawlDelay, nil
 	}
@@ -51,4 +96,18 @@ func (c *Crawler) checkRobotsTxt(task *workerpool.Task) (bool, time.Duration, er
 	}
 
 	return true, crawlDelay, nil
-}
\ No newline at end of file
+}
+
+// robotsSitemaps returns the sitemaps declared by Sitemap: lines in the
+// robots.txt of the seed's host, as cached by robotsFor
+func (c *Crawler) robotsSitemaps(seedURL string) []string {
+	u, err := url.Parse(seedURL)
+	if err != nil {
+		return nil
+	}
+	data := c.robotsFor(u)
+	if data == nil {
+		return nil
+	}
+	return data.Sitemaps
+}
@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope decides which hosts are crawled as part of a seed
+type Scope string
+
+const (
+	ScopeExact       Scope = "exact"       // only the seed host
+	ScopeWWW         Scope = "www"         // the seed host and its www. alias
+	ScopeSubdomains  Scope = "subdomains"  // the seed host and all its subdomains
+	ScopeRegistrable Scope = "registrable" // every host under the registrable domain
+)
+
+// defaultScope treats www.example.com and example.com as one site
+const defaultScope = ScopeWWW
+
+// seedScope is the scope configured for the seed, under its own host or
+// its www. alias as domainConfig finds it
+func (c *Crawler) seedScope(seedHost string) Scope {
+	if cfg, ok := c.seedConfig(seedHost); ok && cfg.Scope != "" {
+		return cfg.Scope
+	}
+	return defaultScope
+}
+
+// domainKey is the key a seed's pages and products are grouped under:
+// the host without www., or the registrable domain such as example.co.uk
+func domainKey(seedHost string, scope Scope) string {
+	seedHost = strings.ToLower(seedHost)
+	switch scope {
+	case ScopeExact:
+		return seedHost
+	case ScopeRegistrable:
+		hostname, port := splitHostPort(seedHost)
+		if etld1, err := publicsuffix.EffectiveTLDPlusOne(hostname); err == nil {
+			return joinHostPort(etld1, port)
+		}
+		return seedHost
+	default:
+		return strings.TrimPrefix(seedHost, "www.")
+	}
+}
+
+// inScope reports whether host belongs to the seed under the scope
+func inScope(seedHost string, scope Scope, host string) bool {
+	seedHost, host = strings.ToLower(seedHost), strings.ToLower(host)
+	if host == seedHost {
+		return true
+	}
+
+	key := domainKey(seedHost, scope)
+	switch scope {
+	case ScopeWWW:
+		return strings.TrimPrefix(host, "www.") == key
+	case ScopeSubdomains, ScopeRegistrable:
+		hostname, port := splitHostPort(host)
+		keyName, keyPort := splitHostPort(key)
+		return port == keyPort && (hostname == keyName || strings.HasSuffix(hostname, "."+keyName))
+	}
+	return false
+}
+
+// domainKeyOf returns the key of the seed whose scope covers the host, or
+// the host itself when no seed does
+func (c *Crawler) domainKeyOf(host string) string {
+	host = strings.ToLower(host)
+	for _, seed := range c.seeds {
+		scope := c.seedScope(seed)
+		if inScope(seed, scope, host) {
+			return domainKey(seed, scope)
+		}
+	}
+	return host
+}
+
+// DomainKey returns the domain key output for the host is grouped under
+func (c *Crawler) DomainKey(host string) string {
+	return c.domainKeyOf(host)
+}
+
+func splitHostPort(host string) (string, string) {
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		return hostname, port
+	}
+	return host, ""
+}
+
+func joinHostPort(hostname, port string) string {
+	if port == "" {
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
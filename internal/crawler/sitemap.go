@@ -1,78 +1,279 @@
 package crawler
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 )
 
-type sitemapIndex struct {
-	XMLName xml.Name `xml:"sitemapindex"`
-	Sitemaps []struct {
-		Loc string `xml:"loc"`
-	} `xml:"sitemap"`
+// sitemapFormat is how a sitemap lists its URLs
+type sitemapFormat int
+
+const (
+	formatURLSet sitemapFormat = iota // <urlset>
+	formatIndex                       // <sitemapindex> of further sitemaps
+	formatText                        // one URL per line
+	formatRSS                         // RSS <item><link>
+	formatAtom                        // Atom <entry><link href>
+)
+
+// SitemapLimits bound the work sitemaps can cause per domain
+type SitemapLimits struct {
+	MaxDepth    int   // index nesting followed below a top-level sitemap
+	MaxSitemaps int   // sitemaps fetched per domain
+	MaxURLs     int   // URLs taken from sitemaps per domain
+	MaxBytes    int64 // decompressed bytes read per sitemap
+}
+
+// DefaultSitemapLimits allow the protocol's largest files (50,000 URLs,
+// 50 MB uncompressed) with room to spare
+func DefaultSitemapLimits() SitemapLimits {
+	return SitemapLimits{
+		MaxDepth:    3,
+		MaxSitemaps: 500,
+		MaxURLs:     100000,
+		MaxBytes:    100 << 20,
+	}
 }
 
-type urlset struct {
-	XMLName xml.Name `xml:"urlset"`
-	URLs    []struct {
+// SetSitemapLimits replaces the sitemap limits
+func (c *Crawler) SetSitemapLimits(limits SitemapLimits) {
+	c.sitemaps.mu.Lock()
+	defer c.sitemaps.mu.Unlock()
+	c.sitemaps.limits = limits
+}
+
+// sitemapEntry is one <url>, <sitemap>, feed item or text line, with
+// the optional metadata of <url> entries
+type sitemapEntry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+	Images     []struct {
 		Loc string `xml:"loc"`
-	} `xml:"url"`
+	} `xml:"image"` // image:image
+	Links []struct {
+		Rel      string `xml:"rel,attr"`
+		Hreflang string `xml:"hreflang,attr"`
+		Href     string `xml:"href,attr"`
+	} `xml:"link"` // xhtml:link alternates
+}
+
+// sitemapTracker keeps the sitemaps read and URLs taken per domain, for
+// cycle detection and the per-domain caps
+type sitemapTracker struct {
+	mu      sync.Mutex
+	limits  SitemapLimits
+	fetched map[string]map[string]bool // domain -> sitemap URLs
+	urls    map[string]int             // domain -> URLs taken
+}
+
+func newSitemapTracker(limits SitemapLimits) *sitemapTracker {
+	return &sitemapTracker{
+		limits:  limits,
+		fetched: make(map[string]map[string]bool),
+		urls:    make(map[string]int),
+	}
 }
 
-func (c *Crawler) checkSitemap(domain string) ([]string, error) {
-	sitemapURLs := []string{
-		domain + "/sitemap.xml",
-		domain + "/sitemap_index.xml",
-		domain + "/sitemap-index.xml",
+// visit claims a sitemap for fetching; it fails for sitemaps already
+// read (an index cycle or a duplicate) and once the domain's cap is hit
+func (t *sitemapTracker) visit(domain, sitemapURL string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fetched := t.fetched[domain]
+	if fetched == nil {
+		fetched = make(map[string]bool)
+		t.fetched[domain] = fetched
+	}
+	if fetched[sitemapURL] || len(fetched) >= t.limits.MaxSitemaps {
+		return false
 	}
+	fetched[sitemapURL] = true
+	return true
+}
 
-	var productURLs []string
+// take counts one URL against the domain's cap
+func (t *sitemapTracker) take(domain string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.urls[domain] >= t.limits.MaxURLs {
+		return false
+	}
+	t.urls[domain]++
+	return true
+}
 
-	for _, sitemapURL := range sitemapURLs {
-		resp, err := http.Get(sitemapURL)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			continue
-		}
-		defer resp.Body.Close()
+func (t *sitemapTracker) maxDepth() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits.MaxDepth
+}
 
-		content, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read sitemap: %w", err)
+func (t *sitemapTracker) maxBytes() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits.MaxBytes
+}
+
+// sitemapFilter is how much of a URL set the crawler takes
+type sitemapFilter int
+
+const (
+	sitemapMatching sitemapFilter = iota // entries matching a product URL pattern
+	sitemapAll                           // every entry: the sitemap lists products
+)
+
+// childFilter is the filter of a sitemap listed in an index: a product
+// name takes every entry, otherwise the index's filter carries over
+func (c *Crawler) childFilter(parent sitemapFilter, child string) sitemapFilter {
+	if c.isProductSitemap(child) {
+		return sitemapAll
+	}
+	return parent
+}
+
+// defaultSitemapPaths are tried on every seed besides the sitemaps its
+// robots.txt declares
+var defaultSitemapPaths = []string{"/sitemap.xml", "/sitemap_index.xml", "/sitemap-index.xml"}
+
+// sitemapCandidates lists the sitemaps to try for a seed: those declared
+// in robots.txt, the default paths and the platform's own paths, resolved
+// against the seed and deduplicated. Platform sitemaps and sitemaps named
+// after products list products; the entries of the others are filtered by
+// URL pattern, since a site's one /sitemap.xml rarely says what it lists.
+func (c *Crawler) sitemapCandidates(seedURL string, platformSitemaps []string) ([]string, map[string]sitemapFilter) {
+	base, err := url.Parse(seedURL)
+	if err != nil {
+		return nil, nil
+	}
+
+	var candidates []string
+	filters := make(map[string]sitemapFilter)
+	add := func(ref string, filter sitemapFilter) {
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		sitemapURL := c.normalizeURL(u.String())
+		if c.isProductSitemap(sitemapURL) {
+			filter = sitemapAll
 		}
+		known, seen := filters[sitemapURL]
+		if !seen {
+			candidates = append(candidates, sitemapURL)
+		}
+		if !seen || filter > known {
+			filters[sitemapURL] = filter
+		}
+	}
 
-		// Check if it's a sitemap index
-		if strings.Contains(string(content), "<sitemapindex") {
-			var index sitemapIndex
-			if err := xml.Unmarshal(content, &index); err != nil {
-				return nil, fmt.Errorf("failed to parse sitemap index: %w", err)
-			}
+	for _, ref := range c.robotsSitemaps(seedURL) {
+		add(ref, sitemapMatching)
+	}
+	for _, path := range defaultSitemapPaths {
+		add(path, sitemapMatching)
+	}
+	for _, path := range platformSitemaps {
+		add(path, sitemapAll)
+	}
+	return candidates, filters
+}
+
+// checkSitemap walks the seed's sitemaps and hands every product entry
+// within the seed's scope to emit as soon as it is decoded. It returns the number of URLs emitted.
+func (c *Crawler) checkSitemap(seedURL, domain string, platformSitemaps []string, emit func(entry sitemapEntry)) int {
+	sitemapURLs, filters := c.sitemapCandidates(seedURL, platformSitemaps)
 
-			for _, sitemap := range index.Sitemaps {
-				if c.isProductSitemap(sitemap.Loc) {
-					urls, err := c.parseSitemapURLs(sitemap.Loc)
-					if err != nil {
-						c.logger.Error("Failed to parse sitemap", "url", sitemap.Loc, "error", err)
-						continue
-					}
-					productURLs = append(productURLs, urls...)
-				}
+	emitted := 0
+	for _, sitemapURL := range sitemapURLs {
+		if !c.walkSitemap(sitemapURL, domain, 0, filters[sitemapURL], func(entry sitemapEntry) bool {
+			// Sitemaps may list other hosts; those outside the seed's
+			// scope are not crawled and do not count against the cap
+			if c.domainKeyOf(hostOf(entry.Loc)) != domain {
+				return true
 			}
-		} else {
-			// Regular sitemap
-			if c.isProductSitemap(sitemapURL) {
-				urls, err := c.parseSitemapURLs(sitemapURL)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse sitemap: %w", err)
-				}
-				productURLs = append(productURLs, urls...)
+			if !c.sitemaps.take(domain) {
+				return false
 			}
+			emit(entry)
+			emitted++
+			return true
+		}) {
+			c.logger.Debug("Sitemap URL cap reached", "domain", domain)
+			break
 		}
 	}
+	return emitted
+}
+
+// walkSitemap streams one sitemap. URL sets, text sitemaps and feeds pass
+// the URLs their filter takes to emit; indexes recurse into the sitemaps
+// they list, down to the depth limit. It returns false once emit refuses
+// more URLs.
+func (c *Crawler) walkSitemap(sitemapURL, domain string, depth int, filter sitemapFilter, emit func(entry sitemapEntry) bool) bool {
+	sitemapURL = c.normalizeURL(sitemapURL)
+	if !c.sitemaps.visit(domain, sitemapURL) {
+		return true
+	}
 
-	return productURLs, nil
+	children, more := c.readSitemap(sitemapURL, filter, emit)
+	for _, child := range children {
+		if !more {
+			break
+		}
+		if depth+1 > c.sitemaps.maxDepth() {
+			c.logger.Debug("Sitemap index nested too deep", "url", child)
+			break
+		}
+		more = c.walkSitemap(child, domain, depth+1, c.childFilter(filter, child), emit)
+	}
+	return more
+}
+
+// readSitemap fetches and streams one sitemap, emitting its URLs and
+// returning the sitemaps it lists if it is an index
+func (c *Crawler) readSitemap(sitemapURL string, filter sitemapFilter, emit func(entry sitemapEntry) bool) ([]string, bool) {
+	// Through the crawler's client: its timeout, User-Agent and context
+	resp, err := c.httpClient.Open(c.ctx, sitemapURL)
+	if err != nil {
+		c.logger.Debug("Failed to fetch sitemap", "url", sitemapURL, "error", err)
+		return nil, true
+	}
+	defer resp.Body.Close()
+
+	body, err := sitemapReader(resp.Body, c.sitemaps.maxBytes())
+	if err != nil {
+		c.logger.Debug("Failed to read sitemap", "url", sitemapURL, "error", err)
+		return nil, true
+	}
+
+	more := true
+	var children []string
+	err = streamSitemap(body, func(format sitemapFormat, entry sitemapEntry) bool {
+		if format == formatIndex {
+			children = append(children, entry.Loc)
+			return true
+		}
+		if filter == sitemapMatching && !c.URLPatternMatch(entry.Loc) {
+			return true
+		}
+		more = emit(entry)
+		return more
+	})
+	if err != nil {
+		// URLs read before the error were emitted already
+		c.logger.Debug("Failed to parse sitemap", "url", sitemapURL, "error", err)
+	}
+	return children, more
 }
 
 func (c *Crawler) isProductSitemap(url string) bool {
@@ -81,27 +282,142 @@ func (c *Crawler) isProductSitemap(url string) bool {
 		strings.Contains(strings.ToLower(url), "prod")
 }
 
-func (c *Crawler) parseSitemapURLs(sitemapURL string) ([]string, error) {
-	resp, err := http.Get(sitemapURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch sitemap: %w", err)
+// sitemapReader decompresses gzipped sitemaps, detected by their magic
+// bytes since servers label .xml.gz files inconsistently, and stops after
+// maxBytes of content
+func sitemapReader(r io.Reader, maxBytes int64) (*bufio.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap: %w", err)
+		}
+		return bufio.NewReader(io.LimitReader(gz, maxBytes)), nil
 	}
-	defer resp.Body.Close()
+	return bufio.NewReader(io.LimitReader(br, maxBytes)), nil
+}
 
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read sitemap content: %w", err)
+// streamSitemap decodes a sitemap entry by entry, so that memory stays
+// flat however large the file. The format is read from the root element,
+// or is text when the content does not start with "<". visit returns
+// false to stop.
+func streamSitemap(r *bufio.Reader, visit func(sitemapFormat, sitemapEntry) bool) error {
+	if !startsWithMarkup(r) {
+		return streamTextSitemap(r, visit)
 	}
 
-	var set urlset
-	if err := xml.Unmarshal(content, &set); err != nil {
-		return nil, fmt.Errorf("failed to parse sitemap URLs: %w", err)
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	format, rooted := formatURLSet, false
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			if !rooted {
+				return errors.New("empty sitemap")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if !rooted {
+			switch start.Name.Local {
+			case "urlset":
+				format = formatURLSet
+			case "sitemapindex":
+				format = formatIndex
+			case "rss":
+				format = formatRSS
+			case "feed":
+				format = formatAtom
+			default:
+				return fmt.Errorf("unknown sitemap root <%s>", start.Name.Local)
+			}
+			rooted = true
+			continue
+		}
+
+		entry, ok, err := decodeSitemapEntry(decoder, format, start)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if entry.Loc = strings.TrimSpace(entry.Loc); entry.Loc != "" && !visit(format, entry) {
+			return nil
+		}
 	}
+}
 
-	var urls []string
-	for _, u := range set.URLs {
-		urls = append(urls, u.Loc)
+// decodeSitemapEntry decodes the element if it is an entry of the format
+func decodeSitemapEntry(decoder *xml.Decoder, format sitemapFormat, start xml.StartElement) (sitemapEntry, bool, error) {
+	var entry sitemapEntry
+	switch {
+	case format == formatURLSet && start.Name.Local == "url",
+		format == formatIndex && start.Name.Local == "sitemap":
+		err := decoder.DecodeElement(&entry, &start)
+		return entry, true, err
+	case format == formatRSS && start.Name.Local == "item":
+		var item struct {
+			Link string `xml:"link"`
+		}
+		err := decoder.DecodeElement(&item, &start)
+		entry.Loc = item.Link
+		return entry, true, err
+	case format == formatAtom && start.Name.Local == "entry":
+		var atom struct {
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		}
+		err := decoder.DecodeElement(&atom, &start)
+		for _, link := range atom.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				entry.Loc = link.Href
+				break
+			}
+		}
+		return entry, true, err
+	}
+	return entry, false, nil
+}
+
+// streamTextSitemap reads one absolute URL per line, skipping the rest
+func streamTextSitemap(r io.Reader, visit func(sitemapFormat, sitemapEntry) bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+			if !visit(formatText, sitemapEntry{Loc: line}) {
+				return nil
+			}
+		}
 	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read text sitemap: %w", err)
+	}
+	return nil
+}
 
-	return urls, nil
-}
\ No newline at end of file
+// startsWithMarkup reports whether the first non-space byte is "<",
+// skipping a UTF-8 byte order mark
+func startsWithMarkup(r *bufio.Reader) bool {
+	for n := 64; ; n *= 2 {
+		peek, err := r.Peek(n)
+		trimmed := bytes.TrimLeft(bytes.TrimPrefix(peek, []byte("\xef\xbb\xbf")), " \t\r\n")
+		if len(trimmed) > 0 {
+			return trimmed[0] == '<'
+		}
+		if err != nil || n >= 4096 {
+			return false
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ecommerce-crawler/internal/models"
+	"ecommerce-crawler/pkg/workerpool"
+)
+
+const (
+	// defaultSitemapPriority is the protocol's value for entries without
+	// a <priority>
+	defaultSitemapPriority = 0.5
+	// sitemapPriorityWeight scales a sitemap priority of 0.0-1.0 into the
+	// frontier score, keeping sitemap URLs between catalog URLs and links
+	sitemapPriorityWeight = 10
+)
+
+// lastModLayouts are the W3C datetime forms sitemaps use
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseLastMod(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// entryMeta turns a sitemap entry's metadata into the task's form
+func entryMeta(entry sitemapEntry) *workerpool.SitemapMeta {
+	meta := &workerpool.SitemapMeta{
+		LastMod:    parseLastMod(entry.LastMod),
+		ChangeFreq: strings.ToLower(strings.TrimSpace(entry.ChangeFreq)),
+		Priority:   defaultSitemapPriority,
+	}
+	if p, err := strconv.ParseFloat(strings.TrimSpace(entry.Priority), 64); err == nil && p >= 0 && p <= 1 {
+		meta.Priority = p
+	}
+	for _, image := range entry.Images {
+		if loc := strings.TrimSpace(image.Loc); loc != "" {
+			meta.Images = append(meta.Images, loc)
+		}
+	}
+	for _, link := range entry.Links {
+		if link.Rel != "alternate" || link.Hreflang == "" || link.Href == "" {
+			continue
+		}
+		if meta.Alternates == nil {
+			meta.Alternates = make(map[string]string)
+		}
+		meta.Alternates[strings.ToLower(link.Hreflang)] = strings.TrimSpace(link.Href)
+	}
+	return meta
+}
+
+// sitemapPriority scores a sitemap URL for the frontier
+func sitemapPriority(meta *workerpool.SitemapMeta) float64 {
+	return prioritySitemap + sitemapPriorityWeight*meta.Priority
+}
+
+// applySitemapMeta adds the sitemap's images, language alternates and
+// lastmod to the product record
+func applySitemapMeta(p *models.Product, meta *workerpool.SitemapMeta) {
+	if meta == nil {
+		return
+	}
+	for _, image := range meta.Images {
+		if !containsString(p.Images, image) {
+			p.Images = append(p.Images, image)
+		}
+	}
+	for lang, href := range meta.Alternates {
+		if p.Alternates == nil {
+			p.Alternates = make(map[string]string)
+		}
+		if _, ok := p.Alternates[lang]; !ok {
+			p.Alternates[lang] = href
+		}
+	}
+	if !meta.LastMod.IsZero() {
+		p.LastMod = meta.LastMod.Format(time.RFC3339)
+	}
+}
+
+// recrawlEntry is what the previous crawl learned about a sitemap URL
+type recrawlEntry struct {
+	Domain    string          `json:"domain"`
+	LastMod   time.Time       `json:"lastmod"`
+	CrawledAt time.Time       `json:"crawled_at"`
+	Product   *models.Product `json:"product,omitempty"`
+}
+
+// recrawlState remembers product URLs of sitemaps with a lastmod between
+// runs, so that products unchanged since the last crawl are not fetched
+// again. Other pages are always fetched, as their links may have changed.
+type recrawlState struct {
+	mu      sync.Mutex
+	entries map[string]*recrawlEntry // URL -> entry
+	listed  map[string]bool          // URLs in this run's sitemaps
+	read    map[string]bool          // domains whose sitemaps were read in full
+}
+
+func newRecrawlState() *recrawlState {
+	return &recrawlState{
+		entries: make(map[string]*recrawlEntry),
+		listed:  make(map[string]bool),
+		read:    make(map[string]bool),
+	}
+}
+
+// SetIncremental turns lastmod-based skipping of unchanged sitemap
+// products on or off; it is off by default
+func (c *Crawler) SetIncremental(enabled bool) {
+	c.incremental = enabled
+}
+
+// recrawlFile is kept next to the output file
+func (c *Crawler) recrawlFile() string {
+	return filepath.Join(filepath.Dir(c.outputFile), "crawl_state.json")
+}
+
+// loadRecrawlState reads the previous crawl's state; a missing file means
+// a first crawl
+func (c *Crawler) loadRecrawlState() error {
+	data, err := os.ReadFile(c.recrawlFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	c.recrawl.mu.Lock()
+	defer c.recrawl.mu.Unlock()
+	return json.Unmarshal(data, &c.recrawl.entries)
+}
+
+// writeRecrawlState keeps the state of this and earlier runs. Entries of
+// a domain whose sitemaps were read in full this run but no longer list
+// them are dropped; nothing is written when no entries are left.
+func (c *Crawler) writeRecrawlState() error {
+	c.recrawl.mu.Lock()
+	for urlStr, entry := range c.recrawl.entries {
+		if c.recrawl.read[entry.Domain] && !c.recrawl.listed[urlStr] {
+			delete(c.recrawl.entries, urlStr)
+		}
+	}
+	if len(c.recrawl.entries) == 0 {
+		c.recrawl.mu.Unlock()
+		if err := os.Remove(c.recrawlFile()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(c.recrawl.entries, "", "  ")
+	c.recrawl.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.recrawlFile(), data, 0644)
+}
+
+// sitemapRead marks the domain's sitemaps as read in full, so that its
+// entries missing from them can be pruned
+func (c *Crawler) sitemapRead(domain string) {
+	c.recrawl.mu.Lock()
+	defer c.recrawl.mu.Unlock()
+	c.recrawl.read[domain] = true
+}
+
+// unchanged reports whether the URL was a product when crawled after its
+// sitemap lastmod. The product is reported again without fetching the page.
+func (c *Crawler) unchanged(domain, urlStr string, meta *workerpool.SitemapMeta) bool {
+	if !c.incremental || meta.LastMod.IsZero() {
+		return false
+	}
+
+	c.recrawl.mu.Lock()
+	c.recrawl.listed[urlStr] = true
+	entry := c.recrawl.entries[urlStr]
+	c.recrawl.mu.Unlock()
+	if entry == nil || entry.Product == nil || entry.Domain != domain || entry.LastMod.Before(meta.LastMod) {
+		return false
+	}
+
+	product := *entry.Product
+	applySitemapMeta(&product, meta)
+	c.productURLs.AddProduct(domain, &product)
+	return true
+}
+
+// recordCrawl stores the product found at a sitemap URL with a lastmod
+// for the next run. A page that is no longer a product is forgotten.
+func (c *Crawler) recordCrawl(task *workerpool.Task, product *models.Product) {
+	if !c.incremental || task.Sitemap == nil || task.Sitemap.LastMod.IsZero() {
+		return
+	}
+	urlStr := c.normalizeURL(task.URL)
+
+	c.recrawl.mu.Lock()
+	defer c.recrawl.mu.Unlock()
+	if product == nil {
+		delete(c.recrawl.entries, urlStr)
+		return
+	}
+	record := *product
+	c.recrawl.entries[urlStr] = &recrawlEntry{
+		Domain:    task.Domain,
+		LastMod:   task.Sitemap.LastMod,
+		CrawledAt: time.Now().UTC(),
+		Product:   &record,
+	}
+}
@@ -0,0 +1,200 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+
+	"ecommerce-crawler/pkg/workerpool"
+)
+
+// notFoundFingerprint describes what a domain serves for a missing URL
+type notFoundFingerprint struct {
+	Title  string
+	Tokens map[string]bool
+}
+
+// minFingerprintTokens is the number of distinct words below which page
+// texts are too thin to compare, as with client-rendered shells
+const minFingerprintTokens = 20
+
+// softNotFoundIndex holds one fingerprint per host. A nil fingerprint
+// means the host answers missing URLs with a real error status.
+type softNotFoundIndex struct {
+	mu     sync.Mutex
+	probes map[string]*sync.Once
+	prints map[string]*notFoundFingerprint
+}
+
+func newSoftNotFoundIndex() *softNotFoundIndex {
+	return &softNotFoundIndex{
+		probes: make(map[string]*sync.Once),
+		prints: make(map[string]*notFoundFingerprint),
+	}
+}
+
+func (idx *softNotFoundIndex) get(host string) *notFoundFingerprint {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.prints[host]
+}
+
+// probeNotFound fetches a URL that cannot exist on the page's host, once
+// per host, and records the response if it was served as a page. Other
+// workers on the host wait for the probe, so no page is judged without it.
+// Like any fetch, the probe obeys robots.txt and the crawl delay.
+func (c *Crawler) probeNotFound(domain, pageURL string) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	host := strings.ToLower(u.Host)
+
+	c.notFound.mu.Lock()
+	once := c.notFound.probes[host]
+	if once == nil {
+		once = &sync.Once{}
+		c.notFound.probes[host] = once
+	}
+	c.notFound.mu.Unlock()
+
+	once.Do(func() { c.probeHost(domain, u, host) })
+}
+
+func (c *Crawler) probeHost(domain string, u *url.URL, host string) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return
+	}
+	probe := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/crawler-probe-" + hex.EncodeToString(token)}
+
+	allowed, crawlDelay, err := c.checkRobotsTxt(&workerpool.Task{URL: probe.String(), Domain: domain})
+	if err != nil || !allowed {
+		c.logger.Debug("Soft 404 probe disallowed", "url", probe.String())
+		return
+	}
+	if err := c.throttle.wait(c.ctx, domain, PageTypeUnknown, crawlDelay); err != nil {
+		return
+	}
+
+	content, err := c.httpClient.FetchWithContext(c.ctx, probe.String())
+	if err != nil {
+		// A real 404 means status codes can be trusted on this host
+		return
+	}
+	a, err := AnalyzePage(probe.String(), content)
+	if err != nil {
+		return
+	}
+
+	c.notFound.mu.Lock()
+	c.notFound.prints[host] = &notFoundFingerprint{
+		Title:  strings.ToLower(a.Title),
+		Tokens: textTokens(a.Text),
+	}
+	c.notFound.mu.Unlock()
+	c.logger.Debug("Host serves soft 404 pages", "host", host)
+}
+
+// isGone reports whether the page is a soft 404 or a removed product
+func (c *Crawler) isGone(a *PageAnalysis) bool {
+	// Structured data marking the product as discontinued
+	for _, node := range findJSONLDType(a.JSONLD, "Product") {
+		for _, offer := range jsonObjects(node["offers"]) {
+			if strings.EqualFold(availabilityName(jsonString(offer["availability"])), "Discontinued") {
+				return true
+			}
+		}
+	}
+
+	// A page describing a product in its structured data or inline state
+	// is there, whatever its text says about other products or variants
+	if len(findJSONLDType(a.JSONLD, "Product")) > 0 || a.State().describesPage(a.URL) {
+		return false
+	}
+
+	// "Not found" phrases in the title, headings or a short main content;
+	// elsewhere they tend to be about a variant or another product
+	notFoundPhrases := c.lexiconFor(a).NotFound
+	title := strings.ToLower(a.Title)
+	if containsAny(title, notFoundPhrases) || errorTitle(title) {
+		return true
+	}
+	if containsAny(a.Headings, notFoundPhrases) {
+		return true
+	}
+	if len(a.MainText) < 2000 && containsAny(a.MainText, notFoundPhrases) {
+		return true
+	}
+
+	// Same content as the host's known-missing page
+	fp := c.notFound.get(hostOf(a.URL))
+	if fp == nil {
+		return false
+	}
+	similarity := jaccard(fp.Tokens, textTokens(a.Text))
+	return similarity >= 0.9 || (fp.Title != "" && fp.Title == title && similarity >= 0.7)
+}
+
+// errorTitle reports whether the title names an HTTP 404: "404" as a word
+// next to "not found" or "error", so that a product called "404 Slim
+// Jeans" is not taken for one
+func errorTitle(title string) bool {
+	words := strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if word != "404" {
+			continue
+		}
+		from, to := i-2, i+3
+		if from < 0 {
+			from = 0
+		}
+		if to > len(words) {
+			to = len(words)
+		}
+		near := " " + strings.Join(words[from:to], " ") + " "
+		if strings.Contains(near, " not found ") || strings.Contains(near, " error ") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(text string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func textTokens(text string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		tokens[word] = true
+	}
+	return tokens
+}
+
+// jaccard is the share of words two texts have in common. Texts too thin
+// to compare, such as empty client-rendered shells, share nothing.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) < minFingerprintTokens || len(b) < minFingerprintTokens {
+		return 0
+	}
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
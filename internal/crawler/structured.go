@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// appendJSONLDNodes flattens parsed JSON-LD into a list of objects,
+// unwrapping arrays and @graph containers
+func appendJSONLDNodes(nodes []map[string]interface{}, data interface{}) []map[string]interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			nodes = appendJSONLDNodes(nodes, item)
+		}
+	case map[string]interface{}:
+		nodes = append(nodes, v)
+		if graph, ok := v["@graph"]; ok {
+			nodes = appendJSONLDNodes(nodes, graph)
+		}
+	}
+	return nodes
+}
+
+// findJSONLDType returns the JSON-LD objects whose @type matches typeName
+func findJSONLDType(nodes []map[string]interface{}, typeName string) []map[string]interface{} {
+	var found []map[string]interface{}
+	for _, node := range nodes {
+		if hasJSONLDType(node, typeName) {
+			found = append(found, node)
+		}
+	}
+	return found
+}
+
+func hasJSONLDType(node map[string]interface{}, typeName string) bool {
+	switch t := node["@type"].(type) {
+	case string:
+		return schemaName(t) == strings.ToLower(typeName)
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok && schemaName(s) == strings.ToLower(typeName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaName strips a schema.org prefix such as "https://schema.org/InStock"
+func schemaName(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndex(value, "/"); i >= 0 {
+		value = value[i+1:]
+	}
+	return strings.ToLower(value)
+}
+
+// jsonString reads a scalar value as a string, following {"name": ...}
+// and {"url": ...} objects and taking the first element of arrays
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		if name := jsonString(v["name"]); name != "" {
+			return name
+		}
+		return jsonString(v["url"])
+	case []interface{}:
+		if len(v) > 0 {
+			return jsonString(v[0])
+		}
+	}
+	return ""
+}
+
+// jsonStrings reads a value that may be a single item or a list
+func jsonStrings(value interface{}) []string {
+	var out []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s := jsonString(item); s != "" {
+				out = append(out, s)
+			}
+		}
+	default:
+		if s := jsonString(v); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
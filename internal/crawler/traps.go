@@ -0,0 +1,240 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TrapLimits bound the URL spaces that calendars, facet combinations and
+// session ids generate
+type TrapLimits struct {
+	MaxURLLength      int // longer URLs are skipped
+	MaxQueryParams    int // URLs with more query parameters are skipped
+	MaxSegmentRepeats int // a path segment may appear at most this often
+	// TemplateBudget is the number of pages fetched per URL template
+	// before its yield is checked
+	TemplateBudget int
+	// MinTemplateYield is the share of a template's fetches that must find
+	// a new product or a new product-like link once its budget is spent
+	MinTemplateYield float64
+}
+
+// DefaultTrapLimits suit product catalogues of a few thousand pages
+func DefaultTrapLimits() TrapLimits {
+	return TrapLimits{
+		MaxURLLength:      1024,
+		MaxQueryParams:    5,
+		MaxSegmentRepeats: 2,
+		TemplateBudget:    50,
+		MinTemplateYield:  0.2,
+	}
+}
+
+// Trap reasons reported with suppressed URL families
+const (
+	TrapURLLength        = "url_length"
+	TrapQueryParams      = "query_params"
+	TrapRepeatedSegments = "repeated_segments"
+	TrapTemplateBudget   = "template_budget"
+)
+
+// SuppressedFamily is a group of URLs sharing a template that the trap
+// heuristics stopped crawling
+type SuppressedFamily struct {
+	Template string `json:"template"`
+	Reason   string `json:"reason"`
+	Count    int    `json:"count"`
+	Example  string `json:"example"`
+}
+
+type templateStats struct {
+	fetched    int
+	productive int
+}
+
+// trapDetector tracks fetches per URL template and the URL families it
+// suppressed, per domain
+type trapDetector struct {
+	mu         sync.Mutex
+	limits     TrapLimits
+	templates  map[string]*templateStats               // domain|template -> stats
+	suppressed map[string]map[string]*SuppressedFamily // domain -> template|reason -> family
+}
+
+func newTrapDetector(limits TrapLimits) *trapDetector {
+	return &trapDetector{
+		limits:     limits,
+		templates:  make(map[string]*templateStats),
+		suppressed: make(map[string]map[string]*SuppressedFamily),
+	}
+}
+
+// SetTrapLimits replaces the trap heuristics' limits
+func (c *Crawler) SetTrapLimits(limits TrapLimits) {
+	c.traps.mu.Lock()
+	defer c.traps.mu.Unlock()
+	c.traps.limits = limits
+}
+
+// check decides whether the URL may be fetched. An allowed URL counts
+// against its template's budget; a refused one is recorded in its family.
+func (t *trapDetector) check(domain, urlStr string) (bool, string) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return true, ""
+	}
+	template := urlTemplate(u)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reason := ""
+	switch {
+	case t.limits.MaxURLLength > 0 && len(urlStr) > t.limits.MaxURLLength:
+		reason = TrapURLLength
+	case t.limits.MaxQueryParams > 0 && len(u.Query()) > t.limits.MaxQueryParams:
+		reason = TrapQueryParams
+	case t.limits.MaxSegmentRepeats > 0 && maxSegmentRepeats(u.Path) > t.limits.MaxSegmentRepeats:
+		reason = TrapRepeatedSegments
+	}
+
+	key := domain + "|" + template
+	stats := t.templates[key]
+	if stats == nil {
+		stats = &templateStats{}
+		t.templates[key] = stats
+	}
+	if reason == "" && t.limits.TemplateBudget > 0 && stats.fetched >= t.limits.TemplateBudget &&
+		float64(stats.productive) < t.limits.MinTemplateYield*float64(stats.fetched) {
+		// Diminishing returns: the template keeps its crawl share only
+		// while enough of its pages lead somewhere new
+		reason = TrapTemplateBudget
+	}
+
+	if reason != "" {
+		t.suppress(domain, template, reason, urlStr)
+		return false, reason
+	}
+	stats.fetched++
+	return true, ""
+}
+
+// record notes whether a fetched page found a new product or new
+// product-like links. A link is new when the frontier admits it, so the
+// visited set tells: facet permutations keep linking to the same
+// products and stop counting as productive once those are queued.
+func (t *trapDetector) record(domain, urlStr string, productive bool) {
+	if !productive {
+		return
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stats := t.templates[domain+"|"+urlTemplate(u)]; stats != nil {
+		stats.productive++
+	}
+}
+
+func (t *trapDetector) suppress(domain, template, reason, example string) {
+	families := t.suppressed[domain]
+	if families == nil {
+		families = make(map[string]*SuppressedFamily)
+		t.suppressed[domain] = families
+	}
+	family := families[template+"|"+reason]
+	if family == nil {
+		family = &SuppressedFamily{Template: template, Reason: reason, Example: example}
+		families[template+"|"+reason] = family
+	}
+	family.Count++
+}
+
+// families returns the suppressed families of a domain, largest first
+func (t *trapDetector) families(domain string) []SuppressedFamily {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var result []SuppressedFamily
+	for _, family := range t.suppressed[domain] {
+		result = append(result, *family)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Template < result[j].Template
+	})
+	return result
+}
+
+// GetSuppressedFamilies returns the URL families the trap heuristics
+// stopped crawling, per domain
+func (c *Crawler) GetSuppressedFamilies() map[string][]SuppressedFamily {
+	c.traps.mu.Lock()
+	domains := make([]string, 0, len(c.traps.suppressed))
+	for domain := range c.traps.suppressed {
+		domains = append(domains, domain)
+	}
+	c.traps.mu.Unlock()
+
+	result := make(map[string][]SuppressedFamily)
+	for _, domain := range domains {
+		result[domain] = c.traps.families(domain)
+	}
+	return result
+}
+
+var (
+	digitRun    = regexp.MustCompile(`\d+`)
+	opaqueToken = regexp.MustCompile(`^[A-Za-z0-9_-]{24,}$`)
+)
+
+// urlTemplate reduces a URL to its family: numbers become {n}, long
+// opaque tokens such as session ids become {id}, and the query keeps only
+// its sorted parameter names. /events/2024/05/12?sort=a&color=b becomes
+// /events/{n}/{n}/{n}?color&sort.
+func urlTemplate(u *url.URL) string {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if opaqueToken.MatchString(segment) && strings.ContainsAny(segment, "0123456789") {
+			segments[i] = "{id}"
+			continue
+		}
+		segments[i] = digitRun.ReplaceAllString(segment, "{n}")
+	}
+	template := "/" + strings.Join(segments, "/")
+
+	var keys []string
+	for key := range u.Query() {
+		keys = append(keys, strings.ToLower(key))
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		template += "?" + strings.Join(keys, "&")
+	}
+	return template
+}
+
+// maxSegmentRepeats counts the most frequent path segment, so that
+// /a/b/a/b/a/b yields 3
+func maxSegmentRepeats(path string) int {
+	counts := make(map[string]int)
+	max := 0
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		counts[segment]++
+		if counts[segment] > max {
+			max = counts[segment]
+		}
+	}
+	return max
+}
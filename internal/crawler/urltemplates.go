@@ -0,0 +1,327 @@
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// minTemplateSupport is the number of confirmed products a template
+	// needs before it is trusted
+	minTemplateSupport = 3
+	// maxTemplateExamples bounds the product paths kept per domain
+	maxTemplateExamples = 500
+)
+
+// LearnedTemplate is a product URL template inferred from confirmed
+// product pages, e.g. "/p/{id}" or "/{slug}-p-{num}.html"
+type LearnedTemplate struct {
+	Template string `json:"template"`
+	Support  int    `json:"support"` // confirmed products matching it
+	Example  string `json:"example"`
+}
+
+// templateLearner clusters confirmed product paths per domain
+type templateLearner struct {
+	mu       sync.RWMutex
+	paths    map[string][]string          // domain -> product paths
+	learned  map[string][]LearnedTemplate // domain -> templates
+	patterns map[string][]string          // domain -> URL regexes
+}
+
+func newTemplateLearner() *templateLearner {
+	return &templateLearner{
+		paths:    make(map[string][]string),
+		learned:  make(map[string][]LearnedTemplate),
+		patterns: make(map[string][]string),
+	}
+}
+
+// strongProductSignal reports whether the page declares itself a product
+// through structured data or og:type, which is trusted for learning
+func (c *Crawler) strongProductSignal(a *PageAnalysis) bool {
+	return c.checkStructuredData(a) || strings.ToLower(a.MetaContent("og:type")) == "product"
+}
+
+// observe adds a confirmed product URL and re-clusters the domain
+func (l *templateLearner) observe(domain, urlStr string) {
+	p := strings.ToLower(pathOf(urlStr))
+	if p == "" || p == "/" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	paths := l.paths[domain]
+	for _, known := range paths {
+		if known == p {
+			return
+		}
+	}
+	if len(paths) >= maxTemplateExamples {
+		return
+	}
+	paths = append(paths, p)
+	l.paths[domain] = paths
+
+	templates := inferTemplates(paths)
+	l.learned[domain] = templates
+	// A fresh slice: readers keep using the one domainPatterns returned
+	patterns := make([]string, 0, len(templates))
+	for _, t := range templates {
+		patterns = append(patterns, templatePattern(t.Template))
+	}
+	l.patterns[domain] = patterns
+}
+
+// domainPatterns returns the domain's learned URL regexes. The slice is
+// never modified once published, so callers may read it unlocked.
+func (l *templateLearner) domainPatterns(domain string) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.patterns[domain]
+}
+
+// GetLearnedTemplates returns the product URL templates learned per domain
+func (c *Crawler) GetLearnedTemplates() map[string][]LearnedTemplate {
+	c.learner.mu.RLock()
+	defer c.learner.mu.RUnlock()
+
+	result := make(map[string][]LearnedTemplate)
+	for domain, templates := range c.learner.learned {
+		if len(templates) > 0 {
+			result[domain] = append([]LearnedTemplate(nil), templates...)
+		}
+	}
+	return result
+}
+
+// writeLearnedTemplates saves the learned templates in the shape of
+// configs/domains.json so they can be promoted to product_url_patterns
+func (c *Crawler) writeLearnedTemplates(file string) error {
+	type entry struct {
+		ProductURLPatterns []string          `json:"product_url_patterns"`
+		Learned            []LearnedTemplate `json:"learned"`
+	}
+
+	out := make(map[string]entry)
+	for domain, templates := range c.GetLearnedTemplates() {
+		e := entry{Learned: templates}
+		for _, t := range templates {
+			e.ProductURLPatterns = append(e.ProductURLPatterns, t.Template)
+		}
+		out[domain] = e
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// inferTemplates abstracts every path, groups paths of the same shape and
+// turns literal segments that differ within a group into {slug}
+func inferTemplates(paths []string) []LearnedTemplate {
+	type group struct {
+		segments [][]string // abstracted segments per path
+		examples []string
+	}
+	groups := make(map[string]*group)
+	var order []string
+
+	for _, p := range paths {
+		segments := abstractPath(p)
+		shape := make([]string, len(segments))
+		for i, s := range segments {
+			if isPlaceholder(s) {
+				shape[i] = s
+			} else {
+				shape[i] = "*"
+			}
+		}
+		key := strings.Join(shape, "/")
+		g := groups[key]
+		if g == nil {
+			g = &group{}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.segments = append(g.segments, segments)
+		g.examples = append(g.examples, p)
+	}
+
+	counts := make(map[string]*LearnedTemplate)
+	for _, key := range order {
+		g := groups[key]
+		template := make([]string, len(g.segments[0]))
+		for i := range template {
+			values := make(map[string]bool)
+			for _, segments := range g.segments {
+				values[segments[i]] = true
+			}
+			if len(values) == 1 || isPlaceholder(g.segments[0][i]) {
+				template[i] = g.segments[0][i]
+			} else {
+				template[i] = "{slug}"
+			}
+		}
+		t := "/" + strings.Join(template, "/")
+		if counts[t] == nil {
+			counts[t] = &LearnedTemplate{Template: t, Example: g.examples[0]}
+		}
+		counts[t].Support += len(g.examples)
+	}
+
+	var templates []LearnedTemplate
+	for _, t := range counts {
+		if t.Support >= minTemplateSupport && distinctive(t.Template) {
+			templates = append(templates, *t)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Support != templates[j].Support {
+			return templates[i].Support > templates[j].Support
+		}
+		return templates[i].Template < templates[j].Template
+	})
+	return templates
+}
+
+var (
+	numberToken = regexp.MustCompile(`^\d+$`)
+	idToken     = regexp.MustCompile(`^[a-z0-9]*\d[a-z0-9]*$`)
+	pageExts    = map[string]bool{".html": true, ".htm": true, ".php": true, ".aspx": true}
+)
+
+// abstractPath turns each path segment into its template form.
+// /women/red-dress-p-12345.html becomes [women {slug}-p-{num}.html].
+func abstractPath(p string) []string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	segments := make([]string, len(parts))
+	for i, part := range parts {
+		segments[i] = abstractSegment(part, i == len(parts)-1)
+	}
+	return segments
+}
+
+func abstractSegment(segment string, last bool) string {
+	ext := path.Ext(segment)
+	if !pageExts[ext] {
+		ext = ""
+	}
+	base := strings.TrimSuffix(segment, ext)
+
+	tokens := strings.FieldsFunc(base, func(r rune) bool { return r == '-' || r == '_' })
+	sep := separator(base)
+	if len(tokens) == 0 {
+		return segment
+	}
+
+	classes := make([]string, len(tokens))
+	placeholders := 0
+	for i, tok := range tokens {
+		switch {
+		case numberToken.MatchString(tok):
+			classes[i] = "{num}"
+			placeholders++
+		case idToken.MatchString(tok):
+			classes[i] = "{id}"
+			placeholders++
+		}
+	}
+
+	if placeholders == 0 {
+		// A multi-word last segment is a product slug
+		if last && len(tokens) > 1 {
+			return "{slug}" + ext
+		}
+		return segment
+	}
+
+	// The trailing run of ids and numbers identifies the product; words
+	// before it (even with numbers inside) form the slug, except a short
+	// marker such as "p" or "dp" right before the id
+	tail := len(tokens)
+	for tail > 0 && classes[tail-1] != "" {
+		tail--
+	}
+	var out []string
+	if tail == len(tokens) {
+		// Id first, slug after: 12345-red-dress
+		head := 0
+		for head < len(tokens) && classes[head] != "" {
+			out = append(out, classes[head])
+			head++
+		}
+		out = append(out, "{slug}")
+		return strings.Join(out, sep) + ext
+	}
+
+	head := tokens[:tail]
+	switch {
+	case len(head) == 1 && len(head[0]) <= 3:
+		out = append(out, head[0])
+	case len(head) >= 2 && len(head[len(head)-1]) <= 3:
+		out = append(out, "{slug}", head[len(head)-1])
+	case len(head) > 0:
+		out = append(out, "{slug}")
+	}
+	out = append(out, classes[tail:]...)
+	return strings.Join(out, sep) + ext
+}
+
+// separator returns the word separator the segment uses
+func separator(s string) string {
+	if i := strings.IndexAny(s, "-_"); i >= 0 {
+		return s[i : i+1]
+	}
+	return "-"
+}
+
+func isPlaceholder(segment string) bool {
+	return strings.Contains(segment, "{")
+}
+
+// distinctive rejects templates too generic to identify products, such
+// as "/{slug}", which would match every top-level page
+func distinctive(template string) bool {
+	for _, segment := range strings.Split(strings.Trim(template, "/"), "/") {
+		if segment != "{slug}" {
+			return true
+		}
+	}
+	return false
+}
+
+// templatePattern compiles a template into a URL regex usable by
+// matchesAny. Absolute and host-relative URLs both match.
+func templatePattern(template string) string {
+	replacer := strings.NewReplacer(
+		regexp.QuoteMeta("{num}"), `\d+`,
+		regexp.QuoteMeta("{id}"), `[a-z0-9]*\d[a-z0-9]*`,
+		regexp.QuoteMeta("{slug}"), `[^/?#]+`,
+	)
+	body := replacer.Replace(regexp.QuoteMeta(strings.ToLower(template)))
+	return `^(?:[a-z]+://[^/]+)?` + body + `/?(?:[?#]|$)`
+}
+
+func pathOf(urlStr string) string {
+	if i := strings.Index(urlStr, "://"); i >= 0 {
+		urlStr = urlStr[i+3:]
+		if j := strings.IndexByte(urlStr, '/'); j >= 0 {
+			urlStr = urlStr[j:]
+		} else {
+			return "/"
+		}
+	}
+	if i := strings.IndexAny(urlStr, "?#"); i >= 0 {
+		urlStr = urlStr[:i]
+	}
+	return urlStr
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"ecommerce-crawler/internal/canonical"
+	"ecommerce-crawler/internal/models"
+)
+
+// defaultVariantParams select a variant of a product rather than a new one
+var defaultVariantParams = []string{
+	"color", "colour", "size", "variant", "variant_id", "variantid",
+	"swatch", "selected", "option", "style",
+}
+
+// variantPath matches a trailing variant selector such as /variant/123
+var variantPath = regexp.MustCompile(`/variants?/[^/]+/?$`)
+
+// productRecord extracts the product and assigns it to its product group
+func (c *Crawler) productRecord(domain string, a *PageAnalysis) *models.Product {
+	p := c.extractProduct(a)
+	c.groupVariant(domain, p, a)
+	return p
+}
+
+// groupVariant rewrites the record to its canonical product URL and sets
+// the group id shared by all of its variants. Sources in order of trust:
+// ProductGroup ids, the canonical link, SKU prefixes, and finally the URL
+// with variant parameters and path segments removed.
+func (c *Crawler) groupVariant(domain string, p *models.Product, a *PageAnalysis) {
+	pageURL := p.URL
+	stripped := c.stripVariant(domain, pageURL)
+
+	canonical := stripped
+	if a.Canonical != "" {
+		if resolved := resolveSameHost(pageURL, a.resolve(a.Canonical)); resolved != "" {
+			canonical = c.normalizeURL(resolved)
+		}
+	}
+
+	groupID := productGroupID(a)
+	switch {
+	case groupID != "":
+		p.GroupID = "group:" + groupID
+	case canonical != stripped:
+		p.GroupID = "canonical:" + canonical
+	case skuPrefix(p.SKU) != "":
+		p.GroupID = "sku:" + skuPrefix(p.SKU)
+	default:
+		p.GroupID = "url:" + stripped
+	}
+
+	p.URL = canonical
+	if pageURL != canonical {
+		p.Variants = append(p.Variants, pageURL)
+	}
+}
+
+// stripVariant removes the domain's variant parameters and variant path
+func (c *Crawler) stripVariant(domain, urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+
+	params := c.domainConfig(domain).VariantParams
+	if len(params) == 0 {
+		params = defaultVariantParams
+	}
+	params = append(append([]string(nil), params...), c.platformProfile(domain).VariantParams...)
+
+	query := u.Query()
+	for key := range query {
+		if canonical.MatchParam(key, params) {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Path = variantPath.ReplaceAllString(u.Path, "")
+
+	return c.normalizeURL(u.String())
+}
+
+// productGroupID reads the parent product id from ProductGroup markup
+func productGroupID(a *PageAnalysis) string {
+	nodes := a.JSONLD
+	for _, group := range findJSONLDType(nodes, "ProductGroup") {
+		if id := jsonString(group["productGroupID"]); id != "" {
+			return id
+		}
+	}
+	for _, product := range findJSONLDType(nodes, "Product") {
+		if id := jsonString(product["inProductGroupWithID"]); id != "" {
+			return id
+		}
+		if parent, ok := product["isVariantOf"].(map[string]interface{}); ok {
+			if id := jsonString(parent["productGroupID"]); id != "" {
+				return id
+			}
+			if id := jsonString(parent["@id"]); id != "" {
+				return id
+			}
+		}
+	}
+
+	for _, prop := range []string{"productGroupID", "inProductGroupWithID"} {
+		if !a.ItemProps[strings.ToLower(prop)] {
+			continue
+		}
+		if s := a.Doc.Find("[itemprop='" + prop + "']").First(); s.Length() > 0 {
+			if id := itempropValue(s); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// skuPrefix returns the style code of a variant SKU such as "LMD001-RED-M".
+// Only SKUs with a style code plus at least two option segments qualify,
+// so that plain codes like "ABCD-1234" are not merged with their neighbours.
+func skuPrefix(sku string) string {
+	parts := strings.FieldsFunc(sku, func(r rune) bool {
+		return r == '-' || r == '_' || r == '/'
+	})
+	if len(parts) < 3 || len(parts[0]) < 4 || !strings.ContainsAny(parts[0], "0123456789") {
+		return ""
+	}
+	return strings.ToUpper(parts[0])
+}
+
+// resolveSameHost resolves href against pageURL and returns it only when
+// it stays on the same host
+func resolveSameHost(pageURL, href string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+	if !strings.EqualFold(resolved.Host, base.Host) {
+		return ""
+	}
+	resolved.Fragment = ""
+	return resolved.String()
+}
@@ -0,0 +1,240 @@
+// Package evaluation measures product detection against a labelled corpus
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LabelProduct marks a corpus page that is a product page; any other
+// label is treated as a negative example. Other labels name the page type,
+// as the crawler does: "listing", "search", "account", "content", "gone".
+const LabelProduct = "product"
+
+// Sample is one labelled page of the corpus
+type Sample struct {
+	File    string `json:"file"`   // HTML file, relative to the corpus directory
+	URL     string `json:"url"`    // URL the page was served from
+	Domain  string `json:"domain"` // Domain the page belongs to
+	Label   string `json:"label"`  // "product" or the page type of a non-product
+	Content string `json:"-"`
+}
+
+// IsProduct reports whether the sample is labelled as a product page
+func (s Sample) IsProduct() bool {
+	return s.Label == LabelProduct
+}
+
+// LoadCorpus reads manifest.json from dir and loads every referenced page
+func LoadCorpus(dir string) ([]Sample, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus manifest: %w", err)
+	}
+
+	var samples []Sample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("failed to parse corpus manifest: %w", err)
+	}
+
+	for i := range samples {
+		content, err := os.ReadFile(filepath.Join(dir, samples[i].File))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read corpus page %s: %w", samples[i].File, err)
+		}
+		samples[i].Content = string(content)
+	}
+	return samples, nil
+}
+
+// Metrics holds the confusion counts and derived scores
+type Metrics struct {
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	TrueNegatives  int     `json:"true_negatives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+	Accuracy       float64 `json:"accuracy"`
+}
+
+func (m *Metrics) add(predicted, actual bool) {
+	switch {
+	case predicted && actual:
+		m.TruePositives++
+	case predicted && !actual:
+		m.FalsePositives++
+	case !predicted && actual:
+		m.FalseNegatives++
+	default:
+		m.TrueNegatives++
+	}
+}
+
+func (m *Metrics) compute() {
+	if total := m.TruePositives + m.FalsePositives + m.TrueNegatives + m.FalseNegatives; total > 0 {
+		m.Accuracy = float64(m.TruePositives+m.TrueNegatives) / float64(total)
+	}
+	if tp := float64(m.TruePositives); tp > 0 {
+		m.Precision = tp / float64(m.TruePositives+m.FalsePositives)
+		m.Recall = tp / float64(m.TruePositives+m.FalseNegatives)
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+}
+
+// Misclassification records a sample the detector got wrong
+type Misclassification struct {
+	Sample    Sample
+	Predicted bool
+}
+
+// Report is the result of evaluating a detector over the corpus
+type Report struct {
+	Overall       Metrics
+	PerDomain     map[string]*Metrics
+	PerLabel      map[string]*Metrics // by page type
+	Misclassified []Misclassification
+}
+
+// Evaluate runs predict over every sample and collects the metrics
+func Evaluate(samples []Sample, predict func(urlStr, content string) bool) *Report {
+	report := &Report{
+		PerDomain: make(map[string]*Metrics),
+		PerLabel:  make(map[string]*Metrics),
+	}
+
+	for _, sample := range samples {
+		predicted := predict(sample.URL, sample.Content)
+		actual := sample.IsProduct()
+
+		report.Overall.add(predicted, actual)
+		domain, ok := report.PerDomain[sample.Domain]
+		if !ok {
+			domain = &Metrics{}
+			report.PerDomain[sample.Domain] = domain
+		}
+		domain.add(predicted, actual)
+		label, ok := report.PerLabel[sample.Label]
+		if !ok {
+			label = &Metrics{}
+			report.PerLabel[sample.Label] = label
+		}
+		label.add(predicted, actual)
+
+		if predicted != actual {
+			report.Misclassified = append(report.Misclassified, Misclassification{
+				Sample:    sample,
+				Predicted: predicted,
+			})
+		}
+	}
+
+	report.Overall.compute()
+	for _, m := range report.PerDomain {
+		m.compute()
+	}
+	for _, m := range report.PerLabel {
+		m.compute()
+	}
+	return report
+}
+
+// Domains returns the evaluated domains in sorted order
+func (r *Report) Domains() []string {
+	domains := make([]string, 0, len(r.PerDomain))
+	for domain := range r.PerDomain {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Labels returns the evaluated page types in sorted order
+func (r *Report) Labels() []string {
+	labels := make([]string, 0, len(r.PerLabel))
+	for label := range r.PerLabel {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// Baseline is the committed minimum for the overall metrics and for the
+// share of each page type classified correctly
+type Baseline struct {
+	Precision float64            `json:"precision"`
+	Recall    float64            `json:"recall"`
+	F1        float64            `json:"f1"`
+	Accuracy  map[string]float64 `json:"accuracy_by_label,omitempty"`
+}
+
+// LoadBaseline reads a committed baseline file
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline: %w", err)
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline: %w", err)
+	}
+	return &baseline, nil
+}
+
+// WriteBaseline records the report's overall and per page type metrics as
+// the new baseline
+func WriteBaseline(path string, r *Report) error {
+	baseline := Baseline{
+		Precision: round(r.Overall.Precision),
+		Recall:    round(r.Overall.Recall),
+		F1:        round(r.Overall.F1),
+		Accuracy:  make(map[string]float64),
+	}
+	for label, m := range r.PerLabel {
+		baseline.Accuracy[label] = round(m.Accuracy)
+	}
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Regressions lists every overall metric and page type accuracy that fell
+// below the baseline
+func (r *Report) Regressions(b *Baseline) []string {
+	var regressions []string
+	check := func(name string, got, want float64) {
+		if round(got) < want {
+			regressions = append(regressions, fmt.Sprintf("%s %.4f below baseline %.4f", name, got, want))
+		}
+	}
+	check("precision", r.Overall.Precision, b.Precision)
+	check("recall", r.Overall.Recall, b.Recall)
+	check("f1", r.Overall.F1, b.F1)
+	for _, label := range sortedKeys(b.Accuracy) {
+		if m, ok := r.PerLabel[label]; ok {
+			check(label+" accuracy", m.Accuracy, b.Accuracy[label])
+		}
+	}
+	return regressions
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// round keeps four decimals so baselines survive a JSON round trip
+func round(v float64) float64 {
+	return float64(int(v*10000+0.5)) / 10000
+}
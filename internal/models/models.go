@@ -6,9 +6,28 @@ type CrawlResult struct {
 	ProductURLs []string `json:"product_urls"`
 }
 
+// Product holds the catalog attributes extracted from a product page
+type Product struct {
+	URL          string            `json:"url"`
+	Name         string            `json:"name,omitempty"`
+	Brand        string            `json:"brand,omitempty"`
+	SKU          string            `json:"sku,omitempty"`
+	GTIN         string            `json:"gtin,omitempty"`
+	Price        string            `json:"price,omitempty"`
+	Currency     string            `json:"currency,omitempty"`
+	Availability string            `json:"availability,omitempty"`
+	Images       []string          `json:"images,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	GroupID      string            `json:"group_id,omitempty"`
+	Variants     []string          `json:"variants,omitempty"`
+	Aliases      []string          `json:"aliases,omitempty"`    // near-duplicate pages
+	Alternates   map[string]string `json:"alternates,omitempty"` // hreflang -> URL
+	LastMod      string            `json:"lastmod,omitempty"`    // from the sitemap
+}
+
 // Task represents a crawling task
 type Task struct {
 	URL    string `json:"url"`
 	Depth  int    `json:"depth"`
 	Domain string `json:"domain"`
-}
\ No newline at end of file
+}
@@ -0,0 +1,131 @@
+// Package simhash fingerprints page text so that near-identical pages,
+// such as print views or mirrors, can be found under different URLs
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// shingleSize is the number of words hashed together
+const shingleSize = 3
+
+// Fingerprint returns the 64-bit SimHash of the text's word shingles and
+// the number of shingles it was computed from. Texts differing in a few
+// words get fingerprints a few bits apart.
+func Fingerprint(text string) (uint64, int) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0, 0
+	}
+
+	size := shingleSize
+	if len(words) < size {
+		size = len(words)
+	}
+
+	var weights [64]int
+	shingles := 0
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		sum := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+		shingles++
+	}
+
+	var fp uint64
+	for b := 0; b < 64; b++ {
+		if weights[b] > 0 {
+			fp |= 1 << b
+		}
+	}
+	return fp, shingles
+}
+
+// Distance is the number of differing bits between two fingerprints
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Index finds fingerprints within a Hamming distance. The fingerprint is
+// split into maxDistance+1 bands; two fingerprints that close share at
+// least one band exactly, so only entries sharing a band are compared.
+type Index struct {
+	maxDistance int
+	bands       []map[uint64][]entry
+}
+
+type entry struct {
+	fp uint64
+	id string
+}
+
+// NewIndex returns an index matching fingerprints at most maxDistance
+// bits apart; 3 suits 64-bit fingerprints of web pages
+func NewIndex(maxDistance int) *Index {
+	if maxDistance < 0 {
+		maxDistance = 0
+	}
+	if maxDistance > 15 {
+		maxDistance = 15
+	}
+	idx := &Index{maxDistance: maxDistance, bands: make([]map[uint64][]entry, maxDistance+1)}
+	for i := range idx.bands {
+		idx.bands[i] = make(map[uint64][]entry)
+	}
+	return idx
+}
+
+// band returns the i-th band of the fingerprint; the last band takes the
+// remaining bits
+func (idx *Index) band(fp uint64, i int) uint64 {
+	width := 64 / len(idx.bands)
+	shift := i * width
+	if i == len(idx.bands)-1 {
+		return fp >> shift
+	}
+	return (fp >> shift) & (1<<width - 1)
+}
+
+// Add indexes the fingerprint under id
+func (idx *Index) Add(fp uint64, id string) {
+	for i, band := range idx.bands {
+		key := idx.band(fp, i)
+		band[key] = append(band[key], entry{fp: fp, id: id})
+	}
+}
+
+// Near returns the ids of indexed fingerprints within maxDistance, the
+// closest first and each id once
+func (idx *Index) Near(fp uint64) []string {
+	best := make(map[string]int)
+	var ids []string
+	for i, band := range idx.bands {
+		for _, e := range band[idx.band(fp, i)] {
+			d := Distance(fp, e.fp)
+			if d > idx.maxDistance {
+				continue
+			}
+			if prev, ok := best[e.id]; !ok {
+				ids = append(ids, e.id)
+				best[e.id] = d
+			} else if d < prev {
+				best[e.id] = d
+			}
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return best[ids[i]] < best[ids[j]] })
+	return ids
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -36,4 +37,9 @@ func (l *Logger) Error(message string, args ...interface{}) {
 
 func (l *Logger) Debug(message string, args ...interface{}) {
 	l.debugLog.Printf(message, args...)
+}
+
+// DisableDebug discards debug output, for tools that print their own reports
+func (l *Logger) DisableDebug() {
+	l.debugLog.SetOutput(io.Discard)
 }
\ No newline at end of file
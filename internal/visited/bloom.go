@@ -0,0 +1,145 @@
+package visited
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+const (
+	// bloomGrowth is the capacity factor of each new filter
+	bloomGrowth = 2
+	// bloomTightening scales the false positive rate of each new filter so
+	// that the total rate stays below the configured one
+	bloomTightening = 0.5
+	// defaultBloomCapacity is the capacity of the first filter
+	defaultBloomCapacity = 1 << 16
+)
+
+// BloomSet is a scalable Bloom filter: when a filter fills up a larger
+// one with a tighter false positive rate is added, so memory grows with
+// the crawl and the total false positive rate stays bounded. A false
+// positive makes the crawler skip a URL it never fetched.
+type BloomSet struct {
+	mu      sync.RWMutex
+	filters []*bloomFilter
+	fpRate  float64
+	count   int
+}
+
+// NewBloomSet returns a scalable Bloom filter whose false positive rate
+// stays below fpRate, e.g. 0.001
+func NewBloomSet(fpRate float64) *BloomSet {
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.001
+	}
+	s := &BloomSet{fpRate: fpRate}
+	// Filter rates r, r·t, r·t², ... sum to r/(1-t), which is fpRate
+	s.filters = []*bloomFilter{newBloomFilter(defaultBloomCapacity, fpRate*(1-bloomTightening))}
+	return s
+}
+
+// Add records the URL and reports whether it was (probably) new
+func (s *BloomSet) Add(url string) bool {
+	h1, h2 := bloomHashes(url)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.contains(h1, h2) {
+		return false
+	}
+	last := s.filters[len(s.filters)-1]
+	if last.count >= last.capacity {
+		last = newBloomFilter(last.capacity*bloomGrowth, last.fpRate*bloomTightening)
+		s.filters = append(s.filters, last)
+	}
+	last.add(h1, h2)
+	s.count++
+	return true
+}
+
+// Contains reports whether the URL was (probably) added
+func (s *BloomSet) Contains(url string) bool {
+	h1, h2 := bloomHashes(url)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.contains(h1, h2)
+}
+
+func (s *BloomSet) contains(h1, h2 uint64) bool {
+	for _, f := range s.filters {
+		if f.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of URLs added
+func (s *BloomSet) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.count
+}
+
+// Close is a no-op for the in-memory filter
+func (s *BloomSet) Close() error {
+	return nil
+}
+
+// bloomFilter is one fixed-size filter of the series
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64 // number of bits
+	k        uint64 // number of hash functions
+	capacity int
+	count    int
+	fpRate   float64
+}
+
+func newBloomFilter(capacity int, fpRate float64) *bloomFilter {
+	// Optimal size and hash count for n items at rate p:
+	// m = -n·ln(p)/ln(2)², k = m/n·ln(2)
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/float64(capacity)*math.Ln2)))
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        k,
+		capacity: capacity,
+		fpRate:   fpRate,
+	}
+}
+
+// Bit positions use double hashing, h1 + i·h2
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+func (f *bloomFilter) contains(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes splits a 128-bit FNV-1a hash into the two base hashes
+func bloomHashes(url string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(url))
+	sum := h.Sum(nil)
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	// A zero step would map all k positions to the same bit
+	return h1, h2 | 1
+}
@@ -0,0 +1,269 @@
+package visited
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	diskMagic        = "VSET0001"
+	diskHeaderSize   = 24 // magic, slot count, entry count
+	diskInitialSlots = 1 << 16
+	// diskMaxLoad is the fill ratio at which the table doubles
+	diskMaxLoad = 0.5
+)
+
+// DiskSet keeps URL fingerprints in an open-addressing hash table stored
+// in a file, so memory stays constant however large the crawl grows. The
+// file survives restarts: reopening it resumes the set. The entry count
+// in the header is only written when the table grows and on Close, so
+// opening a table recounts its slots rather than trusting the header,
+// which is stale after a crash.
+type DiskSet struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	slots uint64
+	count uint64
+}
+
+// OpenDiskSet opens or creates the table at path
+func OpenDiskSet(path string) (*DiskSet, error) {
+	return openDiskSet(path, os.O_RDWR|os.O_CREATE)
+}
+
+// CreateDiskSet creates an empty table at path, replacing any table left
+// by an earlier run
+func CreateDiskSet(path string) (*DiskSet, error) {
+	return openDiskSet(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+}
+
+func openDiskSet(path string, flag int) (*DiskSet, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to open visited set: %w", err)
+	}
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open visited set: %w", err)
+	}
+	s := &DiskSet{path: path, file: file}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open visited set: %w", err)
+	}
+	if info.Size() == 0 {
+		err = s.init(file, diskInitialSlots)
+	} else {
+		err = s.readHeader()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// init sizes an empty file for the given number of slots
+func (s *DiskSet) init(file *os.File, slots uint64) error {
+	if err := file.Truncate(diskHeaderSize + int64(slots)*8); err != nil {
+		return fmt.Errorf("failed to size visited set: %w", err)
+	}
+	s.file, s.slots, s.count = file, slots, 0
+	return s.writeHeader()
+}
+
+func (s *DiskSet) readHeader() error {
+	header := make([]byte, diskHeaderSize)
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		return fmt.Errorf("failed to read visited set header: %w", err)
+	}
+	if string(header[:8]) != diskMagic {
+		return errors.New("not a visited set file")
+	}
+	s.slots = binary.LittleEndian.Uint64(header[8:16])
+	if s.slots == 0 {
+		return errors.New("corrupt visited set header")
+	}
+	count := uint64(0)
+	err := s.scan(s.file, s.slots, func(uint64) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read visited set: %w", err)
+	}
+	s.count = count
+	return nil
+}
+
+// scan calls fn with every key stored in the table file, reading it in
+// chunks
+func (s *DiskSet) scan(file *os.File, slots uint64, fn func(key uint64) error) error {
+	reader := io.NewSectionReader(file, diskHeaderSize, int64(slots)*8)
+	buf := make([]byte, 8*4096)
+	for {
+		n, readErr := io.ReadFull(reader, buf)
+		for i := 0; i+8 <= n; i += 8 {
+			key := binary.LittleEndian.Uint64(buf[i:])
+			if key == 0 {
+				continue
+			}
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func (s *DiskSet) writeHeader() error {
+	header := make([]byte, diskHeaderSize)
+	copy(header, diskMagic)
+	binary.LittleEndian.PutUint64(header[8:16], s.slots)
+	binary.LittleEndian.PutUint64(header[16:24], s.count)
+	_, err := s.file.WriteAt(header, 0)
+	return err
+}
+
+// diskKey maps a URL to a non-zero fingerprint; zero marks an empty slot
+func diskKey(url string) uint64 {
+	if fp := Fingerprint(url); fp != 0 {
+		return fp
+	}
+	return 1
+}
+
+// Add records the URL and reports whether it was new
+func (s *DiskSet) Add(url string) bool {
+	key := diskKey(url)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slot, found, err := s.lookup(key)
+	if err != nil || found {
+		return false
+	}
+	if err := s.writeSlot(slot, key); err != nil {
+		return false
+	}
+	s.count++
+	if float64(s.count) > diskMaxLoad*float64(s.slots) {
+		// A failed grow leaves the fuller table in place, which still works
+		s.grow()
+	}
+	return true
+}
+
+// Contains reports whether the URL was added
+func (s *DiskSet) Contains(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found, err := s.lookup(diskKey(url))
+	return err == nil && found
+}
+
+// Len returns the number of URLs added
+func (s *DiskSet) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.count)
+}
+
+// Close writes the header and closes the file
+func (s *DiskSet) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writeHeader(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// lookup probes linearly from the key's home slot and returns the slot
+// holding the key, or the empty slot where it belongs
+func (s *DiskSet) lookup(key uint64) (uint64, bool, error) {
+	slot := key % s.slots
+	for i := uint64(0); i < s.slots; i++ {
+		value, err := s.readSlot(slot)
+		if err != nil {
+			return 0, false, err
+		}
+		if value == key {
+			return slot, true, nil
+		}
+		if value == 0 {
+			return slot, false, nil
+		}
+		slot = (slot + 1) % s.slots
+	}
+	return 0, false, errors.New("visited set is full")
+}
+
+func (s *DiskSet) readSlot(slot uint64) (uint64, error) {
+	var buf [8]byte
+	if _, err := s.file.ReadAt(buf[:], diskHeaderSize+int64(slot)*8); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func (s *DiskSet) writeSlot(slot, key uint64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], key)
+	_, err := s.file.WriteAt(buf[:], diskHeaderSize+int64(slot)*8)
+	return err
+}
+
+// grow rehashes the table into a file twice the size and swaps it in
+func (s *DiskSet) grow() error {
+	tmpPath := s.path + ".grow"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	old, oldSlots, count := s.file, s.slots, s.count
+	abort := func(err error) error {
+		s.file, s.slots, s.count = old, oldSlots, count
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := s.init(tmp, oldSlots*2); err != nil {
+		return abort(err)
+	}
+
+	// Copy every key into the new table
+	err = s.scan(old, oldSlots, func(key uint64) error {
+		slot, _, err := s.lookup(key)
+		if err != nil {
+			return err
+		}
+		return s.writeSlot(slot, key)
+	})
+	if err != nil {
+		return abort(err)
+	}
+	s.count = count
+
+	if err := s.writeHeader(); err != nil {
+		return abort(err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return abort(err)
+	}
+	return old.Close()
+}
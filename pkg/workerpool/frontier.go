@@ -0,0 +1,117 @@
+package workerpool
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// maxFrontier bounds the number of queued tasks; further tasks are dropped
+const maxFrontier = 100000
+
+// frontier is a best-first queue: Pop returns the task with the highest
+// Priority, oldest first among equals. Push drops URLs the admit check
+// rejects, such as URLs queued before.
+type frontier struct {
+	mu     sync.Mutex
+	tasks  taskHeap
+	admit  func(url string) bool
+	seq    uint64
+	notify chan struct{}
+}
+
+func newFrontier() *frontier {
+	return &frontier{notify: make(chan struct{}, 1)}
+}
+
+// push queues the task unless the frontier is full or the admit check
+// rejects its URL, and reports whether it was queued
+func (f *frontier) push(task *Task) bool {
+	f.mu.Lock()
+	full, admit := len(f.tasks) >= maxFrontier, f.admit
+	f.mu.Unlock()
+	// The check may be slow, e.g. an on-disk set, so it runs unlocked
+	if full || (admit != nil && !admit(task.URL)) {
+		return false
+	}
+
+	f.mu.Lock()
+	// Other pushers may have filled the frontier while the check ran
+	if len(f.tasks) >= maxFrontier {
+		f.mu.Unlock()
+		return false
+	}
+	f.seq++
+	heap.Push(&f.tasks, &queuedTask{task: task, seq: f.seq})
+	f.mu.Unlock()
+
+	f.signal()
+	return true
+}
+
+// pop blocks until a task is available or the context is done
+func (f *frontier) pop(ctx context.Context) (*Task, bool) {
+	for {
+		f.mu.Lock()
+		if len(f.tasks) > 0 {
+			task := heap.Pop(&f.tasks).(*queuedTask).task
+			more := len(f.tasks) > 0
+			f.mu.Unlock()
+			if more {
+				// Pass the wake-up on to the next idle worker
+				f.signal()
+			}
+			return task, true
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-f.notify:
+		}
+	}
+}
+
+func (f *frontier) signal() {
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (f *frontier) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.tasks)
+}
+
+type queuedTask struct {
+	task *Task
+	seq  uint64
+}
+
+// taskHeap is a max-heap on Priority, FIFO among equal priorities
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].task.Priority != h[j].task.Priority {
+		return h[i].task.Priority > h[j].task.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*queuedTask)) }
+
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
@@ -1,10 +1,32 @@
 package workerpool
 
+import "time"
+
 // Task represents a unit of work for the crawler
 type Task struct {
 	URL    string `json:"url"`    // URL to crawl
 	Depth  int    `json:"depth"`  // Current depth of crawling
 	Domain string `json:"domain"` // Domain being crawled
+	Origin string `json:"origin"` // Where the URL was found: anchor, next, canonical, sitemap, ...
+
+	// Priority orders the frontier; higher values are crawled first
+	Priority float64 `json:"priority"`
+
+	// HarvestDepth counts the product-to-product hops that led here; zero
+	// for pages reached by the normal crawl
+	HarvestDepth int `json:"harvest_depth,omitempty"`
+
+	// Sitemap holds what the sitemap said about the URL, if it came from one
+	Sitemap *SitemapMeta `json:"sitemap,omitempty"`
+}
+
+// SitemapMeta is the metadata a sitemap lists with a URL
+type SitemapMeta struct {
+	LastMod    time.Time         `json:"lastmod,omitempty"`
+	ChangeFreq string            `json:"changefreq,omitempty"`
+	Priority   float64           `json:"priority"`             // 0.0 - 1.0, 0.5 when not given
+	Images     []string          `json:"images,omitempty"`     // image:image locations
+	Alternates map[string]string `json:"alternates,omitempty"` // hreflang -> URL
 }
 
 // NewTask creates a new crawling task
@@ -10,7 +10,7 @@ import (
 )
 
 type WorkerPool struct {
-	tasks      chan *Task
+	tasks      *frontier
 	wg         sync.WaitGroup
 	maxWorkers int
 	timeout    time.Duration
@@ -18,18 +18,29 @@ type WorkerPool struct {
 
 func NewWorkerPool(maxWorkers int, timeout time.Duration) *WorkerPool {
 	return &WorkerPool{
-		tasks:      make(chan *Task, 1000),
+		tasks:      newFrontier(),
 		maxWorkers: maxWorkers,
 		timeout:    timeout,
 	}
 }
 
-func (wp *WorkerPool) AddTask(task *Task) {
-	select {
-	case wp.tasks <- task:
-	default:
-		// Drop task if queue is full to prevent deadlock
-	}
+// AddTask queues the task by priority and reports whether it was queued
+func (wp *WorkerPool) AddTask(task *Task) bool {
+	return wp.tasks.push(task)
+}
+
+// SetDedupe sets the check that admits a task's URL to the queue, e.g.
+// adding it to a visited set and rejecting URLs seen before. Without one
+// every task is queued. Call it before adding tasks.
+func (wp *WorkerPool) SetDedupe(admit func(url string) bool) {
+	wp.tasks.mu.Lock()
+	defer wp.tasks.mu.Unlock()
+	wp.tasks.admit = admit
+}
+
+// Pending returns the number of queued tasks
+func (wp *WorkerPool) Pending() int {
+	return wp.tasks.len()
 }
 
 func (wp *WorkerPool) Run(ctx context.Context, processFunc func(task *Task) error, logger *utils.Logger) {
@@ -43,28 +54,25 @@ func (wp *WorkerPool) worker(ctx context.Context, processFunc func(task *Task) e
     defer wp.wg.Done()
 
     for {
-        select {
-        case <-ctx.Done():
+        // Highest-priority task first
+        task, ok := wp.tasks.pop(ctx)
+        if !ok {
             return
-        case task, ok := <-wp.tasks:
-            if !ok {
-                return
-            }
+        }
 
-            _, cancel := context.WithTimeout(ctx, wp.timeout)
-            err := processFunc(task)
-            cancel()
+        _, cancel := context.WithTimeout(ctx, wp.timeout)
+        err := processFunc(task)
+        cancel()
 
-            if err != nil {
-                if errors.Is(err, context.DeadlineExceeded) {
-                    logger.Warn("Task timed out", 
-                        "url", task.URL,
-                        "timeout", wp.timeout.String())
-                } else if ctx.Err() == nil { // Only log if not cancelled
-                    logger.Error("Task failed", 
-                        "url", task.URL, 
-                        "error", err)
-                }
+        if err != nil {
+            if errors.Is(err, context.DeadlineExceeded) {
+                logger.Warn("Task timed out", 
+                    "url", task.URL,
+                    "timeout", wp.timeout.String())
+            } else if ctx.Err() == nil { // Only log if not cancelled
+                logger.Error("Task failed", 
+                    "url", task.URL, 
+                    "error", err)
             }
         }
     }
@@ -72,5 +80,4 @@ func (wp *WorkerPool) worker(ctx context.Context, processFunc func(task *Task) e
 
 func (wp *WorkerPool) Wait() {
 	wp.wg.Wait()
-	close(wp.tasks)
 }
\ No newline at end of file
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+
+	"ecommerce-crawler/internal/canonical"
+)
+
+func TestCanonicalize(t *testing.T) {
+	c := canonical.New()
+	c.SetRules("shop.example", canonical.Rules{Allow: []string{"pid", "page"}})
+	c.SetRules("store.example", canonical.Rules{Deny: []string{"sort"}})
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"default port and case", "HTTPS://WWW.Example.COM:443/Shirts/", "https://www.example.com/Shirts"},
+		{"root path", "http://example.com:80", "http://example.com/"},
+		{"non-default port kept", "http://example.com:8080/a", "http://example.com:8080/a"},
+		{"idn host", "https://bücher.example/buch", "https://xn--bcher-kva.example/buch"},
+		{"unreserved escapes decoded", "https://example.com/%7Euser/%61bc%2f", "https://example.com/~user/abc%2F"},
+		{"dot segments and slashes", "https://example.com/a//b/./c/../d", "https://example.com/a/b/d"},
+		{"tracking and session params", "https://example.com/p?utm_source=x&gclid=1&fbclid=2&sid=9&pid=42", "https://example.com/p?pid=42"},
+		{"path session id", "https://example.com/p/1;jsessionid=ABC123", "https://example.com/p/1"},
+		{"query sorted, fragment dropped", "https://example.com/p?b=2&a=1#reviews", "https://example.com/p?a=1&b=2"},
+		{"domain allow list", "https://www.shop.example/p?pid=7&color=red&ref=home", "https://www.shop.example/p?pid=7"},
+		{"domain deny list", "https://store.example/c?sort=price&page=2", "https://store.example/c?page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Canonicalize(tt.url)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) failed: %v", tt.url, err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
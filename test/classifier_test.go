@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ecommerce-crawler/internal/classifier"
+	"ecommerce-crawler/internal/crawler"
+	"ecommerce-crawler/internal/utils"
+)
+
+func TestClassifierTrainCalibrateAndReload(t *testing.T) {
+	var examples []classifier.Example
+	for i := 0; i < 10; i++ {
+		examples = append(examples,
+			classifier.Example{Features: map[string]float64{"signal:structured_data": 1, "url:#id": 1}, Label: true, Domain: "a.example"},
+			classifier.Example{Features: map[string]float64{"signal:anchor_density": 1, "url:collections": 1}, Label: false, Domain: "a.example"},
+		)
+	}
+
+	model := classifier.Train(examples, classifier.DefaultTrainOptions())
+	model.Calibrate(examples)
+
+	product := map[string]float64{"signal:structured_data": 1, "url:#id": 1}
+	listing := map[string]float64{"signal:anchor_density": 1, "url:collections": 1}
+	if !model.Predict("a.example", product) {
+		t.Errorf("Predict(product) = false, want true")
+	}
+	if model.Predict("a.example", listing) {
+		t.Errorf("Predict(listing) = true, want false")
+	}
+	if _, ok := model.DomainThresholds["a.example"]; !ok {
+		t.Errorf("expected a calibrated threshold for a.example")
+	}
+
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := model.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded, err := classifier.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Probability(product) != model.Probability(product) {
+		t.Errorf("reloaded model gives a different probability")
+	}
+}
+
+func TestCalibratedThresholdAppliesAcrossSubdomains(t *testing.T) {
+	// Probability 0.73 for a page with structured data: below the overall
+	// threshold, above the one calibrated for the domain key
+	model := &classifier.Model{
+		Weights:          map[string]float64{"signal:structured_data": 1},
+		Threshold:        0.9,
+		DomainThresholds: map[string]float64{"fashion.example": 0.6, "example.co.uk": 0.6},
+	}
+	page := `<html><script type="application/ld+json">{"@type":"Product","name":"Dress"}</script></html>`
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{"https://www.fashion.example/", "https://shop.example.co.uk/"},
+		1, 1, time.Millisecond, "test-crawler", "", logger)
+	c.SetDomainConfig("shop.example.co.uk", crawler.DomainConfig{Scope: crawler.ScopeRegistrable})
+	c.SetModel(model)
+
+	for _, u := range []string{"https://www.fashion.example/dress", "https://m.example.co.uk/dress"} {
+		if !c.IsProductPage(u, page) {
+			t.Errorf("IsProductPage(%q) = false, want the calibrated threshold of its domain key", u)
+		}
+	}
+	if c.IsProductPage("https://other.example/dress", page) {
+		t.Errorf("IsProductPage on an uncalibrated domain = true, want the overall threshold")
+	}
+}
@@ -1,15 +1,25 @@
 package test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"ecommerce-crawler/internal/crawler"
+	"ecommerce-crawler/internal/models"
 	"ecommerce-crawler/internal/utils"
+	"ecommerce-crawler/pkg/workerpool"
 )
 
 func TestCrawlerBasicFunctionality(t *testing.T) {
@@ -104,4 +114,1122 @@ func TestRobotsTxtHandling(t *testing.T) {
 	if len(results[tsURL.Host]) != 1 {
 		t.Errorf("Expected 1 product URL (only allowed one), got %d", len(results[tsURL.Host]))
 	}
-}
\ No newline at end of file
+}
+func TestFetchResponseReportsFinalURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte(`<html><body>New</body></html>`))
+	}))
+	defer ts.Close()
+
+	resp, err := crawler.NewHTTPClient(utils.NewLogger()).FetchResponse(context.Background(), ts.URL+"/old")
+	if err != nil {
+		t.Fatalf("FetchResponse failed: %v", err)
+	}
+	if resp.URL != ts.URL+"/new" {
+		t.Errorf("Response.URL = %q, want the URL after the redirect", resp.URL)
+	}
+}
+
+func TestDomainURLMapCollapsesVariants(t *testing.T) {
+	m := &crawler.DomainURLMap{}
+
+	m.AddProduct("shop.example", &models.Product{
+		URL:      "https://shop.example/products/dress",
+		GroupID:  "group:D100",
+		Variants: []string{"https://shop.example/products/dress?color=red"},
+	})
+	m.AddProduct("shop.example", &models.Product{
+		URL:     "https://shop.example/products/dress/variant/42",
+		GroupID: "group:D100",
+	})
+	m.AddProduct("shop.example", &models.Product{
+		URL:     "https://shop.example/products/skirt",
+		GroupID: "group:S200",
+	})
+
+	products := m.Products()["shop.example"]
+	if len(products) != 2 {
+		t.Fatalf("Expected 2 canonical products, got %d", len(products))
+	}
+	dress := products[0]
+	if dress.URL != "https://shop.example/products/dress" || len(dress.Variants) != 2 {
+		t.Errorf("Expected dress with 2 variants, got %s with %v", dress.URL, dress.Variants)
+	}
+}
+
+func TestDomainKeyScopes(t *testing.T) {
+	c := crawler.NewCrawler(
+		context.Background(),
+		[]string{"https://www.westside.com/", "https://shop.example.co.uk/", "https://m.site.com/", "https://api.other.com/", "https://www.northwind.com/"},
+		1, 1, time.Millisecond, "test-crawler", "test_output.json", utils.NewLogger(),
+	)
+	c.SetDomainConfig("shop.example.co.uk", crawler.DomainConfig{Scope: crawler.ScopeRegistrable})
+	c.SetDomainConfig("m.site.com", crawler.DomainConfig{Scope: crawler.ScopeSubdomains})
+	c.SetDomainConfig("api.other.com", crawler.DomainConfig{Scope: crawler.ScopeExact})
+	// Keyed without the seed's www.
+	c.SetDomainConfig("northwind.com", crawler.DomainConfig{Scope: crawler.ScopeSubdomains})
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"www.westside.com", "westside.com"},
+		{"westside.com", "westside.com"},
+		{"m.westside.com", "m.westside.com"},
+		{"shop.example.co.uk", "example.co.uk"},
+		{"blog.example.co.uk", "example.co.uk"},
+		{"m.site.com", "m.site.com"},
+		{"img.m.site.com", "m.site.com"},
+		{"site.com", "site.com"},
+		{"www.api.other.com", "www.api.other.com"},
+		{"img.northwind.com", "northwind.com"},
+	}
+	for _, tt := range tests {
+		if got := c.DomainKey(tt.host); got != tt.want {
+			t.Errorf("DomainKey(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestTrapDetectionSuppressesFamilies(t *testing.T) {
+	// A calendar with endless "next month" links, a repeating path and a
+	// facet URL with too many parameters
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			w.Write([]byte(`<html><body>
+				<a href="/calendar/1">Events</a>
+				<a href="/a/b/a/b/a/b">Loop</a>
+				<a href="/shirts?a=1&b=2&c=3&d=4&e=5&f=6">Facets</a>
+				</body></html>`))
+		case strings.HasPrefix(r.URL.Path, "/calendar/"):
+			month, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/calendar/"))
+			fmt.Fprintf(w, `<html><body><a href="/calendar/%d">Next month</a></body></html>`, month+1)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse test server URL: %v", err)
+	}
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(
+		context.Background(),
+		[]string{ts.URL},
+		2,  // workers
+		50, // maxDepth
+		time.Millisecond,
+		"test-crawler",
+		filepath.Join(t.TempDir(), "test_output.json"),
+		logger,
+	)
+	limits := crawler.DefaultTrapLimits()
+	limits.TemplateBudget = 5
+	c.SetTrapLimits(limits)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	reasons := make(map[string]string)
+	for _, family := range c.GetSuppressedFamilies()[tsURL.Host] {
+		reasons[family.Template] = family.Reason
+	}
+	want := map[string]string{
+		"/calendar/{n}":       crawler.TrapTemplateBudget,
+		"/a/b/a/b/a/b":        crawler.TrapRepeatedSegments,
+		"/shirts?a&b&c&d&e&f": crawler.TrapQueryParams,
+	}
+	for template, reason := range want {
+		if reasons[template] != reason {
+			t.Errorf("family %q suppressed with %q, want %q (got %v)", template, reasons[template], reason, reasons)
+		}
+	}
+}
+
+func TestTrapDetectionSuppressesFacetPermutations(t *testing.T) {
+	// Every colour facet links to the next one and to the same products
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body><a href="/shoes?color=1">Shoes</a></body></html>`))
+		case "/shoes":
+			color, _ := strconv.Atoi(r.URL.Query().Get("color"))
+			fmt.Fprintf(w, `<html><body><a href="/shoes?color=%d">More</a>
+				<a href="/product/1">Boot</a><a href="/product/2">Sneaker</a></body></html>`, color+1)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse test server URL: %v", err)
+	}
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL}, 2, 50, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "test_output.json"), logger)
+	limits := crawler.DefaultTrapLimits()
+	limits.TemplateBudget = 5
+	c.SetTrapLimits(limits)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	for _, family := range c.GetSuppressedFamilies()[tsURL.Host] {
+		if family.Template == "/shoes?color" {
+			if family.Reason != crawler.TrapTemplateBudget {
+				t.Errorf("Facet family suppressed with %q, want %q", family.Reason, crawler.TrapTemplateBudget)
+			}
+			return
+		}
+	}
+	t.Errorf("Facet permutations were never suppressed: %v", c.GetSuppressedFamilies()[tsURL.Host])
+}
+
+func TestLearnsProductURLTemplates(t *testing.T) {
+	products := []string{"red-dress-p-1001", "linen-shirt-p-1002", "denim-jacket-p-1003"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			for _, p := range products {
+				fmt.Fprintf(w, `<a href="/women/%s.html">%s</a>`, p, p)
+			}
+			return
+		}
+		for _, p := range products {
+			if r.URL.Path == "/women/"+p+".html" {
+				fmt.Fprintf(w, `<html><head><meta property="og:type" content="product">
+					<script type="application/ld+json">{"@type":"Product","name":%q}</script></head>
+					<body><div class="breadcrumb">Home &gt; Product</div><button>Add to cart</button></body></html>`, p)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse test server URL: %v", err)
+	}
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	outputFile := filepath.Join(t.TempDir(), "products.json")
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL}, 2, 2, time.Millisecond, "test-crawler", outputFile, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	templates := c.GetLearnedTemplates()[tsURL.Host]
+	if len(templates) != 1 || templates[0].Template != "/women/{slug}-p-{num}.html" || templates[0].Support != 3 {
+		t.Fatalf("unexpected learned templates: %+v", templates)
+	}
+	if !c.URLPatternMatch(ts.URL + "/women/silk-scarf-p-2001.html") {
+		t.Errorf("learned template does not match a new product URL")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(outputFile), "learned_templates.json")); err != nil {
+		t.Errorf("learned templates not written: %v", err)
+	}
+}
+
+func TestWorkerPoolPriorityOrder(t *testing.T) {
+	pool := workerpool.NewWorkerPool(1, time.Second)
+	seen := make(map[string]bool)
+	pool.SetDedupe(func(url string) bool {
+		if seen[url] {
+			return false
+		}
+		seen[url] = true
+		return true
+	})
+	tasks := []*workerpool.Task{
+		{URL: "http://shop.test/blog", Priority: 1},
+		{URL: "http://shop.test/p/1", Priority: 30},
+		{URL: "http://shop.test/", Priority: 100},
+		{URL: "http://shop.test/p/2", Priority: 30},
+		{URL: "http://shop.test/p/1", Priority: 30},
+	}
+	queued := 0
+	for _, task := range tasks {
+		if pool.AddTask(task) {
+			queued++
+		}
+	}
+	if queued != 4 || pool.Pending() != 4 {
+		t.Fatalf("Expected 4 queued tasks after dedupe, got %d (pending %d)", queued, pool.Pending())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan string, len(tasks))
+	pool.Run(ctx, func(task *workerpool.Task) error {
+		done <- task.URL
+		return nil
+	}, utils.NewLogger())
+
+	want := []string{"http://shop.test/", "http://shop.test/p/1", "http://shop.test/p/2", "http://shop.test/blog"}
+	for i, url := range want {
+		select {
+		case got := <-done:
+			if got != url {
+				t.Errorf("Task %d: expected %s, got %s", i, url, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for task %d", i)
+		}
+	}
+}
+
+func TestWorkerPoolFrontierCapUnderConcurrentPushes(t *testing.T) {
+	const capacity = 100000 // workerpool's frontier bound
+	const racers = 8
+
+	pool := workerpool.NewWorkerPool(1, time.Second)
+	var arrived sync.WaitGroup
+	arrived.Add(racers)
+	pool.SetDedupe(func(url string) bool {
+		if strings.HasPrefix(url, "race:") {
+			// Every racer passes the check before any of them inserts
+			arrived.Done()
+			arrived.Wait()
+		}
+		return true
+	})
+
+	for i := 0; i < capacity-1; i++ {
+		pool.AddTask(&workerpool.Task{URL: "fill:" + strconv.Itoa(i)})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pool.AddTask(&workerpool.Task{URL: "race:" + strconv.Itoa(i)})
+		}(i)
+	}
+	wg.Wait()
+
+	if pool.Pending() != capacity {
+		t.Errorf("Frontier holds %d tasks, want at most %d", pool.Pending(), capacity)
+	}
+}
+
+func TestHarvestFollowsProductLinksWithinBudget(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]bool)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path] = true
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<html><body><a href="/product/1">Product 1</a></body></html>`))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/product/") {
+			n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/product/"))
+			if err != nil || n > 4 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `<html><head><meta property="og:type" content="product">
+				<script type="application/ld+json">{"@type":"Product","name":"Item %d"}</script></head>
+				<body><button>Add to cart</button>
+				<div class="similar"><a href="/product/%d">Similar</a><a href="/about">About us</a></div></body></html>`, n, n+1)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL}, 2, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+	c.SetHarvestPolicy(crawler.HarvestPolicy{Enabled: true, MaxDepth: 2, MaxPages: 10})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/product/1", "/product/2", "/product/3"} {
+		if !fetched[path] {
+			t.Errorf("Expected %s to be fetched", path)
+		}
+	}
+	if fetched["/product/4"] {
+		t.Error("Harvest went beyond its depth")
+	}
+	if fetched["/about"] {
+		t.Error("Harvest followed a link that does not look like a product")
+	}
+}
+
+func TestNearDuplicatePagesBecomeAliases(t *testing.T) {
+	// Real pages carry a few hundred words of navigation and footer
+	var footer strings.Builder
+	for i := 1; i <= 150; i++ {
+		fmt.Fprintf(&footer, "<a href=\"/c/%d\">Collection %d</a> ", i, i)
+	}
+	page := func(name, description, extra string) string {
+		return fmt.Sprintf(`<html><head><meta property="og:type" content="product">
+			<script type="application/ld+json">{"@type":"Product","name":%q}</script></head>
+			<body><nav>Home Women Men Kids Sale New arrivals Gift cards Store locator</nav>
+			<h1>%s</h1><p>%s</p><button>Add to cart</button>%s
+			<footer>Free shipping on orders over fifty dollars. Easy returns within thirty days. %s</footer></body></html>`,
+			name, name, description, extra, footer.String())
+	}
+	dress := "A flowing midi dress in washed linen with a square neckline, tie straps and deep side pockets, cut for an easy relaxed fit. The fabric is garment dyed for a soft lived in handle and will keep softening with every wash. Our model is five foot nine and wears a size small; the dress falls just below her knee. Machine wash cold with similar colours, reshape while damp and dry flat in the shade. Made in a family run mill in Portugal from European flax grown without irrigation. Pair it with woven sandals for the beach or a chunky knit and boots once the evenings turn cool."
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body><a href="/product/1">Dress</a><a href="/print/dress">Print</a><a href="/product/2">Shirt</a></body></html>`))
+		case "/product/1":
+			w.Write([]byte(page("Linen Midi Dress", dress, "")))
+		case "/print/dress":
+			w.Write([]byte(page("Linen Midi Dress", dress, "<p>Print</p>")))
+		case "/product/2":
+			w.Write([]byte(page("Oxford Shirt", dress, "")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse test server URL: %v", err)
+	}
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL}, 1, 2, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	products := c.GetProducts()[tsURL.Host]
+	if len(products) != 2 {
+		t.Fatalf("Expected 2 products, got %d", len(products))
+	}
+	for _, p := range products {
+		switch {
+		case strings.HasSuffix(p.URL, "/product/1"):
+			if len(p.Aliases) != 1 || !strings.HasSuffix(p.Aliases[0], "/print/dress") {
+				t.Errorf("Expected the print view as alias of the dress, got %v", p.Aliases)
+			}
+		case strings.HasSuffix(p.URL, "/product/2"):
+			if len(p.Aliases) != 0 {
+				t.Errorf("Different product recorded with aliases %v", p.Aliases)
+			}
+		default:
+			t.Errorf("Unexpected product %s", p.URL)
+		}
+	}
+}
+
+func TestNearDuplicateListingBecomesAlias(t *testing.T) {
+	var footer strings.Builder
+	for i := 1; i <= 150; i++ {
+		fmt.Fprintf(&footer, "<a href=\"/c/%d\">Collection %d</a> ", i, i)
+	}
+	related := `<a href="/product/3">Skirt</a><a href="/product/4">Top</a><a href="/product/5">Coat</a><a href="/product/6">Scarf</a>`
+	page := func(head string) string {
+		return fmt.Sprintf(`<html><head>%s</head>
+			<body><nav>Home Women Men Kids Sale New arrivals Gift cards Store locator</nav>
+			<h1>Linen Midi Dress</h1><p>A flowing midi dress in washed linen with a square neckline, tie straps and deep side pockets, cut for an easy relaxed fit. The fabric is garment dyed for a soft lived in handle and will keep softening with every wash. Machine wash cold with similar colours, reshape while damp and dry flat in the shade.</p>
+			<section>You may also like %s</section>
+			<footer>Free shipping on orders over fifty dollars. Easy returns within thirty days. %s</footer></body></html>`,
+			head, related, footer.String())
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body><a href="/product/1">Dress</a><a href="/share/dress">Share</a></body></html>`))
+		case "/product/1":
+			w.Write([]byte(page(`<meta property="og:type" content="product">
+				<script type="application/ld+json">{"@type":"Product","name":"Linen Midi Dress"}</script>`)))
+		case "/share/dress":
+			// The shared copy drops the product markup
+			w.Write([]byte(page("")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse test server URL: %v", err)
+	}
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL}, 1, 3, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+	if got := c.ClassifyPage(ts.URL+"/share/dress", page("")); got != crawler.PageTypeListing {
+		t.Fatalf("Expected the shared copy to classify as listing, got %s", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	products := c.GetProducts()[tsURL.Host]
+	if len(products) != 1 {
+		t.Fatalf("Expected 1 product, got %d", len(products))
+	}
+	if aliases := products[0].Aliases; len(aliases) != 1 || !strings.HasSuffix(aliases[0], "/share/dress") {
+		t.Errorf("Expected the shared copy as alias of the dress, got %v", aliases)
+	}
+}
+
+func TestSitemapDiscoveryFromRobots(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nAllow: /\nSitemap: %s/feeds/products-sitemap.xml\nSitemap: %s/feeds/products-sitemap.xml\n", ts.URL, ts.URL)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/feeds/products-sitemap.xml</loc></sitemap></sitemapindex>`, ts.URL)
+		case "/feeds/products-sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/item/42</loc></url></urlset>`, ts.URL)
+		case "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		case "/item/42":
+			w.Write([]byte(`<html><head><meta property="og:type" content="product"></head><body>Item</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 1, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["//sitemap.xml"] != 0 {
+		t.Error("Sitemap path was joined with a double slash")
+	}
+	if requests["/feeds/products-sitemap.xml"] == 0 {
+		t.Error("Sitemap declared in robots.txt was not fetched")
+	}
+	if requests["/item/42"] == 0 {
+		t.Error("Product listed in the robots.txt sitemap was not crawled")
+	}
+	if requests["/robots.txt"] != 1 {
+		t.Errorf("robots.txt fetched %d times, want once per host", requests["/robots.txt"])
+	}
+}
+
+func TestRobotsSitemapFiltersEntriesByPattern(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nAllow: /\nSitemap: %s/site.xml\n", ts.URL)
+		case "/site.xml":
+			// A plain name, listing pages of every kind
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/product/linen-shirt</loc></url><url><loc>%[1]s/terms</loc></url></urlset>`, ts.URL)
+		case "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		case "/product/linen-shirt", "/terms":
+			w.Write([]byte(`<html><body>Page</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 1, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/product/linen-shirt"] == 0 {
+		t.Error("Product URL in a plainly named robots.txt sitemap was not crawled")
+	}
+	if requests["/terms"] != 0 {
+		t.Error("Sitemap entry not matching a product URL pattern was crawled")
+	}
+}
+
+func TestSitemapSkipsOffScopeHosts(t *testing.T) {
+	offScope := 0
+	var mu sync.Mutex
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		offScope++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer other.Close()
+
+	fetched := make(map[string]bool)
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path] = true
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/product/elsewhere</loc></url><url><loc>%s/product/here</loc></url></urlset>`, other.URL, ts.URL)
+		case "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		case "/product/here":
+			w.Write([]byte(`<html><body>Item</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 1, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+	limits := crawler.DefaultSitemapLimits()
+	limits.MaxURLs = 1
+	c.SetSitemapLimits(limits)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if offScope != 0 {
+		t.Errorf("Sitemap led to %d requests outside the seed's scope", offScope)
+	}
+	if !fetched["/product/here"] {
+		t.Error("Off-scope sitemap entry used up the URL cap")
+	}
+}
+
+func TestSitemapFetchStopsWithTheCrawl(t *testing.T) {
+	released := make(chan struct{})
+	var once sync.Once
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			// Stalls after the headers until the client gives up
+			w.Write([]byte(`<urlset>`))
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				once.Do(func() { close(released) })
+			case <-time.After(5 * time.Second):
+			}
+		case "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c := crawler.NewCrawler(ctx, []string{ts.URL + "/"}, 1, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Error("Stalled sitemap download outlived the crawl")
+	}
+}
+
+func TestSitemapFormats(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			for _, name := range []string{"products-1.xml.gz", "products.txt", "products.rss", "products.atom"} {
+				fmt.Fprintf(w, "Sitemap: %s/sitemaps/%s\n", ts.URL, name)
+			}
+		case "/sitemaps/products-1.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprintf(gz, `<?xml version="1.0"?><urlset><url><loc>%s/item/1</loc></url></urlset>`, ts.URL)
+			gz.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(buf.Bytes())
+		case "/sitemaps/products.txt":
+			fmt.Fprintf(w, "\xef\xbb\xbf%s/item/2\n\n# comment\n%s/item/3\n", ts.URL, ts.URL)
+		case "/sitemaps/products.rss":
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>New</title><item><title>Four</title><link>%s/item/4</link></item></channel></rss>`, ts.URL)
+		case "/sitemaps/products.atom":
+			fmt.Fprintf(w, `<feed xmlns="http://www.w3.org/2005/Atom"><entry><link rel="alternate" href="%s/item/5"/></entry></feed>`, ts.URL)
+		case "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		default:
+			if strings.HasPrefix(r.URL.Path, "/item/") {
+				w.Write([]byte(`<html><head><meta property="og:type" content="product"></head><body>Item</body></html>`))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 2, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i <= 5; i++ {
+		if requests["/item/"+strconv.Itoa(i)] == 0 {
+			t.Errorf("Product /item/%d from the sitemaps was not crawled", i)
+		}
+	}
+}
+
+func TestSitemapRecursionLimits(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	var ts *httptest.Server
+	index := func(w http.ResponseWriter, children ...string) {
+		fmt.Fprint(w, `<sitemapindex>`)
+		for _, child := range children {
+			fmt.Fprintf(w, `<sitemap><loc>%s%s</loc></sitemap>`, ts.URL, child)
+		}
+		fmt.Fprint(w, `</sitemapindex>`)
+	}
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			index(w, "/sitemap-products-index.xml", "/index-1.xml")
+		case "/sitemap-products-index.xml":
+			// Lists its parent again: a cycle
+			index(w, "/sitemap.xml", "/sitemap-products-1.xml")
+		case "/index-1.xml":
+			index(w, "/index-2.xml")
+		case "/index-2.xml":
+			index(w, "/index-3.xml")
+		case "/index-3.xml":
+			index(w, "/sitemap-products-deep.xml")
+		case "/sitemap-products-1.xml":
+			// The protocol's largest sitemap, streamed
+			fmt.Fprint(w, `<urlset>`)
+			for i := 0; i < 50000; i++ {
+				fmt.Fprintf(w, `<url><loc>%s/item/%d</loc></url>`, ts.URL, i)
+			}
+			fmt.Fprint(w, `</urlset>`)
+		case "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		default:
+			if strings.HasPrefix(r.URL.Path, "/item/") {
+				w.Write([]byte(`<html><body>Item</body></html>`))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 2, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+	limits := crawler.DefaultSitemapLimits()
+	limits.MaxURLs = 3
+	c.SetSitemapLimits(limits)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/sitemap.xml"] != 1 {
+		t.Errorf("Sitemap index fetched %d times, want 1", requests["/sitemap.xml"])
+	}
+	if requests["/sitemap-products-deep.xml"] != 0 {
+		t.Error("Sitemap nested beyond the depth limit was fetched")
+	}
+	items := 0
+	for path := range requests {
+		if strings.HasPrefix(path, "/item/") {
+			items++
+		}
+	}
+	if items != 3 {
+		t.Errorf("Expected 3 sitemap URLs crawled under the cap, got %d", items)
+	}
+}
+
+func TestSitemapMetadataAndIncrementalRecrawl(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	listed := true
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		withProduct := listed
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			product := ""
+			if withProduct {
+				product = fmt.Sprintf(`<url><loc>%[1]s/product/1</loc><lastmod>2024-05-01</lastmod><priority>0.9</priority>
+					<image:image><image:loc>%[1]s/img/1.jpg</image:loc></image:image>
+					<xhtml:link rel="alternate" hreflang="de-DE" href="%[1]s/de/product/1"/>
+				</url>`, ts.URL)
+			}
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+				xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+				xmlns:xhtml="http://www.w3.org/1999/xhtml">%s
+				<url><loc>%s/pages/lookbook</loc><lastmod>2024-05-01</lastmod></url>
+				</urlset>`, product, ts.URL)
+		case "/product/1":
+			w.Write([]byte(`<html><head><meta property="og:type" content="product">
+				<script type="application/ld+json">{"@type":"Product","name":"Item 1"}</script></head>
+				<body><button>Add to cart</button></body></html>`))
+		case "/", "/pages/lookbook":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	output := filepath.Join(t.TempDir(), "products.json")
+	crawl := func() map[string][]*models.Product {
+		logger := utils.NewLogger()
+		logger.DisableDebug()
+		c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 2, 1, time.Millisecond,
+			"test-crawler", output, logger)
+		c.SetIncremental(true)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := c.Start(ctx); err != nil {
+			t.Fatalf("Crawler failed: %v", err)
+		}
+		return c.GetProducts()
+	}
+
+	check := func(run string, products map[string][]*models.Product) {
+		for _, list := range products {
+			for _, p := range list {
+				if !strings.HasSuffix(p.URL, "/product/1") {
+					continue
+				}
+				if len(p.Images) == 0 || p.Images[len(p.Images)-1] != ts.URL+"/img/1.jpg" {
+					t.Errorf("%s: sitemap image missing: %v", run, p.Images)
+				}
+				if p.Alternates["de-de"] != ts.URL+"/de/product/1" {
+					t.Errorf("%s: hreflang alternate missing: %v", run, p.Alternates)
+				}
+				if !strings.HasPrefix(p.LastMod, "2024-05-01") {
+					t.Errorf("%s: lastmod = %q", run, p.LastMod)
+				}
+				return
+			}
+		}
+		t.Errorf("%s: product from the sitemap not found", run)
+	}
+
+	check("first run", crawl())
+	mu.Lock()
+	first, firstPage := fetched["/product/1"], fetched["/pages/lookbook"]
+	mu.Unlock()
+	if first == 0 {
+		t.Fatal("Product page was not fetched")
+	}
+
+	// Unchanged since the first run: the product is reported again without
+	// a fetch, while other pages are fetched for their links
+	check("second run", crawl())
+	mu.Lock()
+	if fetched["/product/1"] != first {
+		t.Error("Unchanged sitemap product was fetched again")
+	}
+	if fetched["/pages/lookbook"] == firstPage {
+		t.Error("Unchanged non-product sitemap URL was skipped")
+	}
+	listed = false
+	mu.Unlock()
+
+	// Dropped from the sitemap: forgotten by the crawl state
+	crawl()
+	state, err := os.ReadFile(filepath.Join(filepath.Dir(output), "crawl_state.json"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read crawl state: %v", err)
+	}
+	if strings.Contains(string(state), "/product/1") {
+		t.Errorf("Crawl state kept a URL no longer in the sitemap: %s", state)
+	}
+}
+
+func TestListingDepthOverrunIsBounded(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]bool)
+	listing := func(w http.ResponseWriter, n int) {
+		fmt.Fprintf(w, `<html><head><link rel="next" href="/product/list-%d?page=2"></head><body>`, n)
+		for i := 0; i < 4; i++ {
+			fmt.Fprintf(w, `<a href="/product/list-%d">Tile</a>`, n+1)
+			fmt.Fprintf(w, `<a href="/product/item-%d-%d">Item</a>`, n, i)
+		}
+		fmt.Fprint(w, `<a href="/about-us">About</a></body></html>`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path] = true
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/":
+			listing(w, 0)
+		case strings.HasPrefix(r.URL.Path, "/product/list-"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/product/list-"))
+			listing(w, n)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 2, 0, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !fetched["/product/list-1"] || !fetched["/product/list-2"] {
+		t.Errorf("Product-like links past max depth not followed: %v", fetched)
+	}
+	if fetched["/product/list-3"] {
+		t.Error("Listing chain went beyond the depth overrun cap")
+	}
+	if fetched["/about-us"] {
+		t.Error("Listing past max depth expanded a link that is neither a product nor pagination")
+	}
+}
+
+func TestSoftNotFoundSkipsClientRenderedShells(t *testing.T) {
+	// The host answers every path with the same empty 200 shell; product
+	// data only arrives as inline state
+	shell := `<html><head><title>Shop</title><meta property="og:type" content="product"></head><body><div id="root"></div>%s</body></html>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, shell, `<a href="/red-dress/p/1234567">Red Dress</a>`)
+		case "/red-dress/p/1234567":
+			fmt.Fprintf(w, shell, `<script id="__NEXT_DATA__" type="application/json">
+				{"props":{"pageProps":{"product":{"productId":"1234567","name":"Red Dress","price":1299}}}}
+				</script>`)
+		default:
+			fmt.Fprintf(w, shell, "")
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 2, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	for _, urls := range c.GetProductURLs() {
+		for _, u := range urls {
+			if strings.HasSuffix(u, "/red-dress/p/1234567") {
+				return
+			}
+		}
+	}
+	t.Errorf("Inline-state product on a soft 404 host was dropped: %v", c.GetProductURLs())
+}
+
+func TestSoftNotFoundProbeObeysRobots(t *testing.T) {
+	var mu sync.Mutex
+	probes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /crawler-probe-\n"))
+		case r.URL.Path == "/":
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		case strings.HasPrefix(r.URL.Path, "/crawler-probe-"):
+			mu.Lock()
+			probes++
+			mu.Unlock()
+			w.Write([]byte(`<html><body>Welcome</body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 1, 0, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if probes != 0 {
+		t.Errorf("Soft 404 probe fetched a path robots.txt disallows")
+	}
+}
+
+func TestCatalogFeedsStayInScope(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]bool)
+	offScope := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		offScope++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer other.Close()
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path] = true
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/":
+			w.Header().Set("X-ShopId", "1")
+			w.Write([]byte(`<html><head><script src="//cdn.shopify.com/s/files/theme.js"></script></head><body>Shop</body></html>`))
+		case r.URL.Path == "/products.json":
+			w.Write([]byte(`{"products":[{"handle":"json-item"}]}`))
+		case r.URL.Path == "/collections/all.atom":
+			fmt.Fprintf(w, `<feed xmlns="http://www.w3.org/2005/Atom">
+				<entry><link rel="alternate" href="%s/products/feed-item"/></entry>
+				<entry><link rel="alternate" href="%s/products/elsewhere"/></entry>
+				</feed>`, ts.URL, other.URL)
+		case strings.HasPrefix(r.URL.Path, "/products/"):
+			w.Write([]byte(`<html><head><meta property="og:type" content="product"></head><body><button>Add to cart</button></body></html>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{ts.URL + "/"}, 2, 1, time.Millisecond,
+		"test-crawler", filepath.Join(t.TempDir(), "products.json"), logger)
+	c.SetCatalogDiscovery(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Crawler failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/products/json-item", "/products/feed-item"} {
+		if !fetched[path] {
+			t.Errorf("Expected catalog product %s to be fetched", path)
+		}
+	}
+	if offScope != 0 {
+		t.Errorf("Catalog feed led to %d requests outside the seed's scope", offScope)
+	}
+}
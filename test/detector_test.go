@@ -2,9 +2,14 @@ package test
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"ecommerce-crawler/internal/crawler"
+	"ecommerce-crawler/internal/simhash"
 	"ecommerce-crawler/internal/utils"
 )
 
@@ -83,10 +88,12 @@ func TestIsProductPage(t *testing.T) {
 			expected: false,
 		},
 		{
-			name:    "product page with breadcrumbs",
+			// Category pages share breadcrumbs and /p/ paths; without the
+			// page declaring itself a product they stay below the threshold
+			name:    "product URL with breadcrumbs only",
 			url:     "https://example.com/p/789",
 			content: `<html><body><div class="breadcrumb">Home > Products > Product Name</div></body></html>`,
-			expected: true,
+			expected: false,
 		},
 	}
 
@@ -98,4 +105,431 @@ func TestIsProductPage(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestClassifyPage(t *testing.T) {
+	logger := utils.NewLogger()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	tests := []struct {
+		name     string
+		url      string
+		content  string
+		expected crawler.PageType
+	}{
+		{
+			name:     "cart page",
+			url:      "https://example.com/cart",
+			content:  `<html><body><button>Checkout</button></body></html>`,
+			expected: crawler.PageTypeAccount,
+		},
+		{
+			name:     "search results",
+			url:      "https://example.com/catalog?q=dress",
+			content:  `<html><body><a href="/product/1">Dress</a></body></html>`,
+			expected: crawler.PageTypeSearch,
+		},
+		{
+			name: "category listing",
+			url:  "https://example.com/collections/dresses",
+			content: `<html><body>
+				<a href="/product/1">A</a><a href="/product/2">B</a>
+				<a href="/product/3">C</a><a href="/product/4">D</a>
+				</body></html>`,
+			expected: crawler.PageTypeListing,
+		},
+		{
+			name:     "blog article",
+			url:      "https://example.com/blog/summer-trends",
+			content:  `<html><head><meta property="og:type" content="article"></head></html>`,
+			expected: crawler.PageTypeContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := c.ClassifyPage(tt.url, tt.content)
+			if result != tt.expected {
+				t.Errorf("ClassifyPage(%q) = %v, want %v", tt.url, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtractProduct(t *testing.T) {
+	logger := utils.NewLogger()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	content := `<html><head>
+		<meta property="og:image" content="https://cdn.example.com/og.jpg">
+		<meta property="product:price:currency" content="USD">
+		<script type="application/ld+json">
+		{"@context":"https://schema.org","@graph":[{"@type":"Product","name":"Linen Dress",
+		 "brand":{"@type":"Brand","name":"Acme"},"sku":"LD-1","gtin13":"0123456789012",
+		 "image":["https://cdn.example.com/1.jpg"],
+		 "offers":{"@type":"Offer","price":49.5,"priceCurrency":"INR","availability":"https://schema.org/InStock"}}]}
+		</script></head><body></body></html>`
+
+	p := c.ExtractProduct("https://example.com/product/1", content)
+	if p.Name != "Linen Dress" || p.Brand != "Acme" || p.SKU != "LD-1" || p.GTIN != "0123456789012" {
+		t.Errorf("unexpected identity fields: %+v", p)
+	}
+	if p.Price != "49.5" || p.Currency != "INR" || p.Availability != "InStock" {
+		t.Errorf("unexpected offer fields: %+v", p)
+	}
+	if len(p.Images) != 2 || p.Images[0] != "https://cdn.example.com/1.jpg" {
+		t.Errorf("unexpected images: %v", p.Images)
+	}
+}
+
+func TestIsProductPageInlineState(t *testing.T) {
+	logger := utils.NewLogger()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	head := `<html><head><meta property="product:price:amount" content="1299"></head><body>`
+	state := `<script id="__NEXT_DATA__" type="application/json">
+		{"props":{"pageProps":{"product":{"productId":"1234567","name":"Red Dress","price":1299}}}}
+		</script>`
+	pageURL := "https://example.com/red-dress/p/1234567"
+
+	if c.IsProductPage(pageURL, head+"</body></html>") {
+		t.Errorf("IsProductPage without inline state = true, want false")
+	}
+	if !c.IsProductPage(pageURL, head+state+"</body></html>") {
+		t.Errorf("IsProductPage with inline state = false, want true")
+	}
+
+	// Nuxt 2 ships its state as a function call; repeated values are
+	// passed as arguments
+	nuxt := `<script>window.__NUXT__=(function(a,b,c){return {layout:"default",
+		data:[{product:{productId:a,name:'Red Dress \u2013 Linen',price:1299,inStock:!0,
+		discount:b,tags:[c,"linen"],sizes:{"S":.5,M:void 0}}}],serverRendered:true}}("1234567",null,"new"));</script>`
+	if !c.IsProductPage(pageURL, head+nuxt+"</body></html>") {
+		t.Errorf("IsProductPage with Nuxt 2 state = false, want true")
+	}
+}
+
+func TestAnalyzePage(t *testing.T) {
+	content := `<html><head>
+		<title>Dress</title>
+		<link rel="canonical" href="https://example.com/product/1">
+		<meta property="og:type" content="product">
+		<script type="application/ld+json">{"@type":"Product","name":"Dress"}</script>
+		</head><body>
+		<div class="breadcrumb">Home &gt; Product</div>
+		<a href="/product/2">Similar</a><button>Add to Cart</button>
+		</body></html>`
+
+	a, err := crawler.AnalyzePage("https://example.com/product/1", content)
+	if err != nil {
+		t.Fatalf("AnalyzePage failed: %v", err)
+	}
+	if a.Title != "Dress" || a.Canonical != "https://example.com/product/1" || a.MetaContent("og:type") != "product" {
+		t.Errorf("unexpected head facts: title=%q canonical=%q", a.Title, a.Canonical)
+	}
+	if len(a.Anchors) != 1 || a.Anchors[0].Href != "/product/2" || a.AnchorCount != 1 {
+		t.Errorf("unexpected anchors: %+v", a.Anchors)
+	}
+	if len(a.JSONLD) != 1 || len(a.CTATexts) != 2 || a.Breadcrumbs == "" {
+		t.Errorf("unexpected body facts: jsonld=%d cta=%v breadcrumbs=%q", len(a.JSONLD), a.CTATexts, a.Breadcrumbs)
+	}
+}
+
+func TestClassifyPageSoftNotFound(t *testing.T) {
+	logger := utils.NewLogger()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "not found phrase",
+			content: `<html><head><meta property="og:type" content="product"></head><body><main><h1>This product is no longer available.</h1></main><button>Add to Cart</button></body></html>`,
+		},
+		{
+			name: "discontinued availability",
+			content: `<html><head><meta property="og:type" content="product">
+				<script type="application/ld+json">{"@type":"Product","name":"Dress","offers":{"availability":"https://schema.org/Discontinued"}}</script>
+				</head><body><button>Add to Cart</button></body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "https://example.com/product/old-dress"
+			if got := c.ClassifyPage(url, tt.content); got != crawler.PageTypeGone {
+				t.Errorf("ClassifyPage() = %v, want %v", got, crawler.PageTypeGone)
+			}
+			if c.IsProductPage(url, tt.content) {
+				t.Errorf("IsProductPage() = true for a removed product")
+			}
+		})
+	}
+}
+
+func TestClassifyPageNotGone(t *testing.T) {
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "404 in the product name",
+			content: `<html><head><title>Levi's 404 Slim Jeans</title><meta property="og:type" content="product"></head>
+				<body><h1>Levi's 404 Slim Jeans</h1><button>Add to Cart</button></body></html>`,
+		},
+		{
+			name: "variant message outside the main content",
+			content: `<html><head><title>Linen Shirt</title><meta property="og:type" content="product"></head>
+				<body><h1>Linen Shirt</h1><div class="sizes">Size M no longer available</div><button>Add to Cart</button></body></html>`,
+		},
+		{
+			name: "product JSON-LD",
+			content: `<html><head><title>Page not found</title>
+				<script type="application/ld+json">{"@type":"Product","name":"Dress","offers":{"price":"10"}}</script>
+				</head><body><button>Add to Cart</button></body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.ClassifyPage("https://example.com/product/404-slim", tt.content); got == crawler.PageTypeGone {
+				t.Errorf("ClassifyPage() = %v for a live product", got)
+			}
+		})
+	}
+}
+
+func TestIsProductPageLexicon(t *testing.T) {
+	logger := utils.NewLogger()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+	c.SetDomainConfig("tienda.example", crawler.DomainConfig{Language: "es"})
+
+	body := `<head><meta property="product:price:amount" content="899"></head><body>
+		<div class="breadcrumb">होम &gt; उत्पाद</div>
+		<button>कार्ट में जोड़ें</button>
+		</body></html>`
+	pageURL := "https://dukaan.example/product/kurta-123"
+
+	if c.IsProductPage(pageURL, "<html>"+body) {
+		t.Errorf("IsProductPage without a language = true, want false")
+	}
+	if !c.IsProductPage(pageURL, `<html lang="hi-IN">`+body) {
+		t.Errorf("IsProductPage with Hindi lexicon = false, want true")
+	}
+
+	spanish := `<html><head><meta property="product:price:amount" content="49"></head><body>
+		<div class="breadcrumb">Inicio &gt; Producto</div>
+		<button>Añadir al carrito</button>
+		</body></html>`
+	if !c.IsProductPage("https://tienda.example/product/vestido-9", spanish) {
+		t.Errorf("IsProductPage with configured Spanish lexicon = false, want true")
+	}
+}
+
+func TestDetectPlatform(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *crawler.Response
+		want crawler.Platform
+	}{
+		{
+			name: "shopify header and cdn",
+			resp: &crawler.Response{
+				Header: http.Header{"X-Shopid": {"123"}},
+				Body:   `<html><head><script src="//cdn.shopify.com/s/files/theme.js"></script></head></html>`,
+			},
+			want: crawler.PlatformShopify,
+		},
+		{
+			name: "shopify powered-by header",
+			resp: &crawler.Response{
+				Header: http.Header{"Powered-By": {"Shopify"}},
+				Body:   `<html><head><script src="/assets/app.js"></script></head></html>`,
+			},
+			want: crawler.PlatformShopify,
+		},
+		{
+			name: "woocommerce generator",
+			resp: &crawler.Response{
+				Body: `<html><head><meta name="generator" content="WooCommerce 8.2.1"></head></html>`,
+			},
+			want: crawler.PlatformWooCommerce,
+		},
+		{
+			name: "salesforce cookies and static path",
+			resp: &crawler.Response{
+				Cookies: []*http.Cookie{{Name: "dwsid", Value: "x"}},
+				Body:    `<html><head><script src="/on/demandware.static/Sites-Store/main.js"></script></head></html>`,
+			},
+			want: crawler.PlatformSFCC,
+		},
+		{
+			name: "image path is not magento",
+			resp: &crawler.Response{
+				Body: `<html><head><script src="/assets/image/lazyload.js"></script></head></html>`,
+			},
+			want: crawler.PlatformCustom,
+		},
+		{
+			name: "custom stack",
+			resp: &crawler.Response{
+				Header: http.Header{"Server": {"nginx"}},
+				Body:   `<html><head><script src="/assets/app.js"></script></head></html>`,
+			},
+			want: crawler.PlatformCustom,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.resp.URL = "https://shop.example/"
+			if got := crawler.DetectPlatform(tt.resp); got != tt.want {
+				t.Errorf("DetectPlatform() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlatformURLPatterns(t *testing.T) {
+	logger := utils.NewLogger()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	productURL := "https://shop.example/products/linen-shirt"
+	if c.URLPatternMatch(productURL) {
+		t.Errorf("URLPatternMatch(%q) without a platform = true, want false", productURL)
+	}
+	c.SetPlatform("shop.example", crawler.PlatformShopify)
+	if !c.URLPatternMatch(productURL) {
+		t.Errorf("URLPatternMatch(%q) on Shopify = false, want true", productURL)
+	}
+}
+
+func TestAnalyzePageLinkSources(t *testing.T) {
+	content := `<html><head>
+		<link rel="canonical" href="/shirts">
+		<link rel="next" href="/shirts?page=2">
+		<link rel="alternate" hreflang="hi" href="/hi/shirts">
+		<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+		</head><body>
+		<a href="/about">About</a>
+		<map><area href="/sale" alt="Sale"></map>
+		<noscript><a href="/shirts?page=1&amp;nojs=1">All shirts</a></noscript>
+		<div class="tile" data-href="/product/linen-shirt"></div>
+		</body></html>`
+
+	a, err := crawler.AnalyzePage("https://example.com/shirts", content)
+	if err != nil {
+		t.Fatalf("AnalyzePage failed: %v", err)
+	}
+
+	want := map[string]crawler.LinkOrigin{
+		"/shirts":               crawler.OriginCanonical,
+		"/shirts?page=2":        crawler.OriginNext,
+		"/hi/shirts":            crawler.OriginAlternate,
+		"/about":                crawler.OriginAnchor,
+		"/sale":                 crawler.OriginArea,
+		"/shirts?page=1&nojs=1": crawler.OriginNoscript,
+		"/product/linen-shirt":  crawler.OriginData,
+	}
+	got := make(map[string]crawler.LinkOrigin)
+	for _, link := range a.Links {
+		got[link.Href] = link.Origin
+	}
+	for href, origin := range want {
+		if got[href] != origin {
+			t.Errorf("link %q origin = %q, want %q", href, got[href], origin)
+		}
+	}
+	if _, ok := got["/feed.xml"]; ok {
+		t.Errorf("feed alternate should not be collected")
+	}
+}
+
+func TestAnalyzePageBaseAndRefresh(t *testing.T) {
+	content := `<html><head>
+		<base href="/store/">
+		<meta http-equiv="refresh" content="0; URL='/store/new-arrivals'">
+		</head><body><a href="shirts">Shirts</a></body></html>`
+
+	a, err := crawler.AnalyzePage("https://example.com/old/index.html", content)
+	if err != nil {
+		t.Fatalf("AnalyzePage failed: %v", err)
+	}
+
+	base, err := a.BaseURL()
+	if err != nil || base.String() != "https://example.com/store/" {
+		t.Errorf("BaseURL() = %v, %v, want https://example.com/store/", base, err)
+	}
+	if base.ResolveReference(&url.URL{Path: a.Anchors[0].Href}).String() != "https://example.com/store/shirts" {
+		t.Errorf("relative anchor did not resolve against <base href>")
+	}
+
+	found := false
+	for _, link := range a.Links {
+		if link.Origin == crawler.OriginRefresh && link.Href == "/store/new-arrivals" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("meta refresh target missing from links: %+v", a.Links)
+	}
+}
+
+func TestSimHashIndex(t *testing.T) {
+	// Real pages carry a few hundred words of navigation and footer
+	var footer strings.Builder
+	for i := 1; i <= 150; i++ {
+		fmt.Fprintf(&footer, " Collection %d", i)
+	}
+	text := footer.String() + "A flowing midi dress in washed linen with a square neckline, tie straps and deep side pockets, cut for an easy relaxed fit. The fabric is garment dyed for a soft lived in handle and will keep softening with every wash. Our model is five foot nine and wears a size small; the dress falls just below her knee. Machine wash cold with similar colours, reshape while damp and dry flat in the shade. Made in a family run mill in Portugal from European flax grown without irrigation. Pair it with woven sandals for the beach or a chunky knit and boots once the evenings turn cool."
+	a, _ := simhash.Fingerprint(text)
+	b, _ := simhash.Fingerprint(text + " Print")
+	c, _ := simhash.Fingerprint(footer.String() + "Slim chinos in stretch cotton twill with a mid rise, zip fly and five pockets, finished with a tapered leg. " +
+		"The cloth is brushed on the inside for warmth and holds a crease through a long working day. " +
+		"Machine washable at thirty degrees; tumble dry low and press with a warm iron while slightly damp.")
+
+	if d := simhash.Distance(a, b); d > 3 {
+		t.Errorf("Near-identical texts are %d bits apart", d)
+	}
+	if d := simhash.Distance(a, c); d <= 3 {
+		t.Errorf("Different texts are only %d bits apart", d)
+	}
+
+	index := simhash.NewIndex(3)
+	index.Add(a, "dress")
+	index.Add(c, "chinos")
+	if near := index.Near(b); len(near) != 1 || near[0] != "dress" {
+		t.Errorf("Expected [dress] near the print view, got %v", near)
+	}
+}
+
+func TestAnalyzePageLinkTexts(t *testing.T) {
+	content := `<html><body>
+		<a href="/product/linen-shirt">Linen shirt</a>
+		<a href="">Quick view</a>
+		<a href="javascript:void(0)">Wishlist</a>
+		<a href="/collections/shirts">All shirts</a>
+		</body></html>`
+
+	a, err := crawler.AnalyzePage("https://example.com/", content)
+	if err != nil {
+		t.Fatalf("AnalyzePage failed: %v", err)
+	}
+
+	want := map[string]string{
+		"/product/linen-shirt": "linen shirt",
+		"/collections/shirts":  "all shirts",
+	}
+	if len(a.Links) != len(want) {
+		t.Errorf("got %d links, want %d: %+v", len(a.Links), len(want), a.Links)
+	}
+	for _, link := range a.Links {
+		if text, ok := want[link.Href]; !ok || link.Text != text {
+			t.Errorf("link %q text = %q, want %q", link.Href, link.Text, text)
+		}
+	}
+}
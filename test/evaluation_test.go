@@ -0,0 +1,33 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"ecommerce-crawler/internal/crawler"
+	"ecommerce-crawler/internal/evaluation"
+	"ecommerce-crawler/internal/utils"
+)
+
+func TestDetectorCorpusBaseline(t *testing.T) {
+	samples, err := evaluation.LoadCorpus("corpus")
+	if err != nil {
+		t.Fatalf("Failed to load corpus: %v", err)
+	}
+	baseline, err := evaluation.LoadBaseline("corpus/baseline.json")
+	if err != nil {
+		t.Fatalf("Failed to load baseline: %v", err)
+	}
+
+	logger := utils.NewLogger()
+	logger.DisableDebug()
+	c := crawler.NewCrawler(context.Background(), []string{}, 1, 3, 1, "", "", logger)
+
+	report := evaluation.Evaluate(samples, c.IsProductPage)
+	for _, m := range report.Misclassified {
+		t.Logf("misclassified %s (predicted product=%v)", m.Sample.File, m.Predicted)
+	}
+	for _, regression := range report.Regressions(baseline) {
+		t.Errorf("detector regression: %s", regression)
+	}
+}
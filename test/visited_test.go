@@ -0,0 +1,126 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"ecommerce-crawler/internal/visited"
+)
+
+func TestVisitedSetBackends(t *testing.T) {
+	disk, err := visited.OpenDiskSet(filepath.Join(t.TempDir(), "visited.db"))
+	if err != nil {
+		t.Fatalf("Failed to open disk set: %v", err)
+	}
+	backends := map[string]visited.Set{
+		"hash":  visited.NewHashSet(),
+		"bloom": visited.NewBloomSet(0.001),
+		"disk":  disk,
+	}
+
+	for name, set := range backends {
+		t.Run(name, func(t *testing.T) {
+			defer set.Close()
+			if !set.Add("https://shop.example/p/1") {
+				t.Error("First Add reported a known URL")
+			}
+			if set.Add("https://shop.example/p/1") {
+				t.Error("Second Add reported a new URL")
+			}
+			if !set.Contains("https://shop.example/p/1") || set.Contains("https://shop.example/p/2") {
+				t.Error("Contains disagrees with Add")
+			}
+			if set.Len() != 1 {
+				t.Errorf("Expected Len 1, got %d", set.Len())
+			}
+		})
+	}
+}
+
+func TestBloomSetFalsePositiveRate(t *testing.T) {
+	set := visited.NewBloomSet(0.01)
+	const n = 100000 // more than the first filter holds
+	for i := 0; i < n; i++ {
+		set.Add(fmt.Sprintf("https://shop.example/p/%d", i))
+	}
+	for i := 0; i < n; i += 1000 {
+		if !set.Contains(fmt.Sprintf("https://shop.example/p/%d", i)) {
+			t.Fatalf("Bloom filter lost URL %d", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if set.Contains(fmt.Sprintf("https://other.example/p/%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.01 {
+		t.Errorf("False positive rate %.4f above 0.01", rate)
+	}
+}
+
+func TestDiskSetGrowsAndReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visited.db")
+	set, err := visited.OpenDiskSet(path)
+	if err != nil {
+		t.Fatalf("Failed to open disk set: %v", err)
+	}
+	const n = 40000 // beyond the initial table's load limit
+	for i := 0; i < n; i++ {
+		set.Add(fmt.Sprintf("https://shop.example/p/%d", i))
+	}
+	if err := set.Close(); err != nil {
+		t.Fatalf("Failed to close disk set: %v", err)
+	}
+
+	set, err = visited.OpenDiskSet(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen disk set: %v", err)
+	}
+	if set.Len() != n {
+		t.Errorf("Expected %d URLs after reopening, got %d", n, set.Len())
+	}
+	for i := 0; i < n; i += 997 {
+		if !set.Contains(fmt.Sprintf("https://shop.example/p/%d", i)) {
+			t.Fatalf("Disk set lost URL %d", i)
+		}
+	}
+	if err := set.Close(); err != nil {
+		t.Fatalf("Failed to close disk set: %v", err)
+	}
+
+	// A fresh crawl starts from an empty table
+	set, err = visited.CreateDiskSet(path)
+	if err != nil {
+		t.Fatalf("Failed to recreate disk set: %v", err)
+	}
+	defer set.Close()
+	if set.Len() != 0 || set.Contains("https://shop.example/p/0") {
+		t.Errorf("Recreated disk set kept %d URLs", set.Len())
+	}
+}
+
+func TestDiskSetRecountsAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visited.db")
+	set, err := visited.OpenDiskSet(path)
+	if err != nil {
+		t.Fatalf("Failed to open disk set: %v", err)
+	}
+	defer set.Close()
+	const n = 1000 // below the load limit, so the header is never rewritten
+	for i := 0; i < n; i++ {
+		set.Add(fmt.Sprintf("https://shop.example/p/%d", i))
+	}
+
+	// Reopen without Close, as a resumed run does after a crash
+	resumed, err := visited.OpenDiskSet(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen disk set: %v", err)
+	}
+	defer resumed.Close()
+	if resumed.Len() != n {
+		t.Errorf("Expected %d URLs after a crash, got %d", n, resumed.Len())
+	}
+}